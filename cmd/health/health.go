@@ -1,27 +1,49 @@
-package health
+package main
 
 import (
 	"flag"
 	"fmt"
 	"github.com/Frank-Way/note-go-rest-service/internal/server"
-	"net/http"
+	"io"
+	"log"
 	"os"
+	"time"
 )
 
 var (
 	configPath string
+	probe      string
 )
 
 func init() {
 	flag.StringVar(&configPath, "config-path", "config.yaml", "path to config path")
+	flag.StringVar(&probe, "probe", "readyz", "probe to check: livez or readyz")
 }
 
 func main() {
 	flag.Parse()
 
+	if probe != "livez" && probe != "readyz" {
+		log.Fatalf("unknown probe: %s", probe)
+	}
 	config := server.NewConfig(configPath)
-	_, err := http.Get(fmt.Sprintf("http://%s:%s/health", config.Listen.BindIP, config.Listen.Port))
+	client, baseUrl, err := server.NewProbeClient(config, 2*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	resp, err := client.Get(baseUrl + "/" + probe)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	report, err := io.ReadAll(resp.Body)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(report))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		os.Exit(1)
 	}
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/Frank-Way/note-go-rest-service/internal/server"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata"
 )
 
 var (
@@ -19,8 +24,11 @@ func main() {
 
 	config := server.NewConfig(configPath)
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	s := server.NewServer(config)
-	if err := s.Start(); err != nil {
+	if err := s.Start(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
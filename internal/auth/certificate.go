@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// CertificateMapper maps subjects of verified client certificates to
+// logins, so that clients with certificates may be authorized without
+// token. Subjects are matched by their RFC 2253 form, e.g.
+// "CN=alice,OU=dev,O=Example", when UseCommonName is set unmapped subjects
+// fall back to their common name.
+type CertificateMapper struct {
+	subjects      map[string]string
+	useCommonName bool
+	logger        *logrus.Logger
+}
+
+func NewCertificateMapper(subjects map[string]string, useCommonName bool, logger *logrus.Logger) *CertificateMapper {
+	normalized := make(map[string]string, len(subjects))
+	for subject, login := range subjects {
+		normalized[strings.ToLower(subject)] = login
+	}
+	return &CertificateMapper{
+		subjects:      normalized,
+		useCommonName: useCommonName,
+		logger:        logger,
+	}
+}
+
+func (cm *CertificateMapper) Login(cert *x509.Certificate) (string, bool) {
+	subject := cert.Subject.String()
+	if login, ok := cm.subjects[strings.ToLower(subject)]; ok {
+		return login, true
+	}
+	if cm.useCommonName && cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, true
+	}
+	return "", false
+}
+
+// Middleware puts login of verified client certificate to request context.
+func (cm *CertificateMapper) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			if login, ok := cm.Login(cert); ok {
+				cm.logger.Debugf("client certificate %q is mapped to %q", cert.Subject.String(), login)
+				r = r.WithContext(WithCertificateLogin(r.Context(), login))
+			} else {
+				cm.logger.Debugf("client certificate %q is not mapped to any login", cert.Subject.String())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserPrincipals returns principals of existing users, logins of client
+// certificates are resolved by it, so that only active users are authorized
+// and their roles are applied.
+type UserPrincipals interface {
+	GetPrincipal(ctx context.Context, login string) (Principal, error)
+}
+
+type certificateLoginKey struct{}
+
+func WithCertificateLogin(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, certificateLoginKey{}, login)
+}
+
+func CertificateLoginFromContext(ctx context.Context) (string, bool) {
+	login, ok := ctx.Value(certificateLoginKey{}).(string)
+	return login, ok && login != ""
+}
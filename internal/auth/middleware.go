@@ -3,43 +3,120 @@ package auth
 import (
 	"context"
 	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"strings"
+	"time"
 )
 
 type Middleware struct {
 	authSrv Service
+	users   UserPrincipals
 	logger  *logrus.Logger
 }
 
-func NewMiddleware(authSrv Service, logger *logrus.Logger) *Middleware {
+// NewMiddleware returns middleware authenticating requests, users may be nil
+// when client certificates are not accepted.
+func NewMiddleware(authSrv Service, users UserPrincipals, logger *logrus.Logger) *Middleware {
 	return &Middleware{
 		authSrv: authSrv,
+		users:   users,
 		logger:  logger,
 	}
 }
 
-func (m *Middleware) CheckAndParse(ctx context.Context, authStr string) (string, error) {
-	m.logger.Debug("check if authStr is empty")
+// Authenticate puts principal of request credentials to request context.
+// Bearer tokens are preferred over client certificates. Requests without
+// credentials or with invalid ones are passed on, so that operations which
+// do not require principal may still be performed, the others are rejected
+// by Authorize.
+func (m *Middleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx, m.logger)
+		p, err := m.authenticate(ctx, r.Header.Get("Authorization"))
+		switch {
+		case err != nil:
+			logger.Debugf("error during authentication: %v", err)
+			ctx = withAuthenticationError(ctx, err)
+		case p != nil:
+			logging.SetLogin(ctx, p.Login)
+			ctx = WithPrincipal(ctx, *p)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *Middleware) authenticate(ctx context.Context, authStr string) (*Principal, error) {
+	logger := logging.FromContext(ctx, m.logger)
+	logger.Debug("check if authStr is empty")
 	if authStr == "" {
-		m.logger.Debug("authStr is empty")
-		return "", fmt.Errorf("authStr string is empty")
+		if login, ok := CertificateLoginFromContext(ctx); ok {
+			logger.Debug("resolve user of client certificate")
+			if m.users == nil {
+				return nil, problem.Unauthorized.WithDetail("client certificates are not accepted")
+			}
+			p, err := m.users.GetPrincipal(ctx, login)
+			if err != nil {
+				logger.Debugf("error during resolving user of client certificate: %v", err)
+				return nil, err
+			}
+			logger.Debug("client is authorized by certificate")
+			return &p, nil
+		}
+		logger.Debug("authStr is empty")
+		return nil, nil
 	}
-	m.logger.Debug("check authStr format")
+	logger.Debug("check authStr format")
 	authParts := strings.Split(authStr, " ")
 	if len(authParts) != 2 || authParts[0] != "Bearer" {
-		m.logger.Debug("wrong authStr format")
-		return "", fmt.Errorf("wrong authStr string format")
+		logger.Debug("wrong authStr format")
+		return nil, problem.Unauthorized.WithDetail("wrong authorization format, bearer token is expected")
 	}
-	m.logger.Debug("parse auth token")
-	login, err := m.authSrv.ParseToken(ctx, authParts[1])
+	logger.Debug("parse auth token")
+	claims, err := m.authSrv.ParseTokenClaims(ctx, authParts[1])
 	if err != nil {
-		m.logger.Debugf("error during token parsing: %v", err)
-		return "", err
+		logger.Debugf("error during token parsing: %v", err)
+		return nil, problem.Unauthorized.Wrap(err).WithDetail("invalid or expired token")
 	}
-	return login, nil
+	p := newPrincipal(claims)
+	return &p, nil
+}
+
+func (m *Middleware) GetToken(ctx context.Context, login string, roles []string) (string, error) {
+	return m.authSrv.GenerateToken(ctx, login, roles)
+}
+
+func (m *Middleware) ListSessions(ctx context.Context, login string) (Sessions, error) {
+	return m.authSrv.ListSessions(ctx, login)
+}
+
+func (m *Middleware) RevokeSession(ctx context.Context, id string) error {
+	return m.authSrv.RevokeSession(ctx, id)
+}
+
+func (m *Middleware) GetVerificationToken(ctx context.Context, login string, email string,
+	ttl time.Duration) (string, error) {
+	return m.authSrv.GenerateVerificationToken(ctx, login, email, ttl)
+}
+
+func (m *Middleware) CheckVerificationToken(ctx context.Context, token string) (string, string, error) {
+	logger := logging.FromContext(ctx, m.logger)
+	logger.Debug("check if verification token is empty")
+	if token == "" {
+		logger.Debug("verification token is empty")
+		return "", "", fmt.Errorf("verification token is empty")
+	}
+	logger.Debug("parse verification token")
+	return m.authSrv.ParseVerificationToken(ctx, token)
+}
+
+func (m *Middleware) RevokeTokens(ctx context.Context, login string) error {
+	return m.authSrv.RevokeTokens(ctx, login)
 }
 
-func (m *Middleware) GetToken(ctx context.Context, login string) (string, error) {
-	return m.authSrv.GenerateToken(ctx, login)
+func (m *Middleware) DeleteSessions(ctx context.Context, login string) error {
+	return m.authSrv.DeleteSessions(ctx, login)
 }
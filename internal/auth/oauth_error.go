@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// OAuthError is an error response defined by RFC 6749.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+	// untrusted is set when redirect uri of request can not be trusted,
+	// so the error must not be redirected back to the client.
+	untrusted bool
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{
+		Code:        code,
+		Description: description,
+		Status:      status,
+	}
+}
+
+func errInvalidRequest(description string) *OAuthError {
+	return newOAuthError(http.StatusBadRequest, "invalid_request", description)
+}
+
+func errInvalidClient(description string) *OAuthError {
+	err := newOAuthError(http.StatusUnauthorized, "invalid_client", description)
+	err.untrusted = true
+	return err
+}
+
+func errInvalidRedirectUri(description string) *OAuthError {
+	err := newOAuthError(http.StatusBadRequest, "invalid_request", description)
+	err.untrusted = true
+	return err
+}
+
+func errInvalidGrant(description string) *OAuthError {
+	return newOAuthError(http.StatusBadRequest, "invalid_grant", description)
+}
+
+func errInvalidScope(description string) *OAuthError {
+	return newOAuthError(http.StatusBadRequest, "invalid_scope", description)
+}
+
+func errUnauthorized(description string) *OAuthError {
+	return newOAuthError(http.StatusUnauthorized, "invalid_token", description)
+}
+
+type appHandler func(w http.ResponseWriter, r *http.Request) error
+
+func oauthErrorMiddleware(h appHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil {
+			return
+		}
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			oauthErr = newOAuthError(http.StatusInternalServerError, "server_error", err.Error())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if oauthErr.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		w.WriteHeader(oauthErr.Status)
+		json.NewEncoder(w).Encode(oauthErr)
+	}
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/sirupsen/logrus"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+type OAuthHandler struct {
+	service OAuthService
+	logger  *logrus.Logger
+}
+
+func NewOAuthHandler(service OAuthService, logger *logrus.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+const (
+	clientsPath    = "/api/v1/oauth/clients"
+	authorizePath  = "/api/v1/oauth/authorize"
+	tokenPath      = "/api/v1/oauth/token"
+	introspectPath = "/api/v1/oauth/introspect"
+	revokePath     = "/api/v1/oauth/revoke"
+)
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Client.Name}}</title></head>
+<body>
+<h1>{{.Client.Name}} wants to access your notes</h1>
+<p>The application asks for the following permissions:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<form method="post" action="` + authorizePath + `">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}{{if .Login}}<p>Signed in as {{.Login}}</p>
+{{else}}<p><label>Login <input name="login" autocomplete="username"></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password"></label></p>
+{{end}}<button name="action" value="approve">Allow</button>
+<button name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+type consentPage struct {
+	Client Client
+	Scopes []string
+	Params map[string]string
+	Login  string
+	Error  string
+}
+
+func (h *OAuthHandler) Handler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle oauth request")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == clientsPath:
+		logger.Debug("delegate to register client handler")
+		return h.registerClientHandler(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == authorizePath:
+		logger.Debug("delegate to consent handler")
+		return h.consentHandler(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == authorizePath:
+		logger.Debug("delegate to authorize handler")
+		return h.authorizeHandler(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == tokenPath:
+		logger.Debug("delegate to token handler")
+		return h.tokenHandler(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == introspectPath:
+		logger.Debug("delegate to introspect handler")
+		return h.introspectHandler(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == revokePath:
+		logger.Debug("delegate to revoke handler")
+		return h.revokeHandler(w, r)
+	default:
+		logger.Debug("no handlers for request")
+		return errInvalidRequest(fmt.Sprintf("wrong method %s on path: %s", r.Method, r.URL.Path))
+	}
+}
+
+func (h *OAuthHandler) Middleware() http.HandlerFunc {
+	return oauthErrorMiddleware(h.Handler)
+}
+
+func (h *OAuthHandler) registerClientHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle register client request")
+	var dto RegisterClientDTO
+	logger.Debug("decoding register client dto from json")
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		logger.Debugf("error during decoding json: %v", err)
+		return errInvalidRequest(err.Error())
+	}
+	logger.Debug("pass dto to service")
+	client, err := h.service.RegisterClient(r.Context(), dto)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	return writeJson(w, http.StatusCreated, client)
+}
+
+func (h *OAuthHandler) consentHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle consent request")
+	req := authorizeRequestFromValues(r.URL.Query())
+	logger.Debug("pass authorize request to service")
+	client, scopes, err := h.service.ValidateAuthorizeRequest(r.Context(), req)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return h.authorizeError(w, r, req, err)
+	}
+	return h.renderConsent(w, r, http.StatusOK, client, scopes, req, "")
+}
+
+func (h *OAuthHandler) authorizeHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle authorize request")
+	if err := r.ParseForm(); err != nil {
+		logger.Debugf("error during parsing form: %v", err)
+		return errInvalidRequest(err.Error())
+	}
+	req := authorizeRequestFromValues(r.PostForm)
+	var (
+		redirect string
+		err      error
+	)
+	if r.PostForm.Get("action") == "approve" {
+		logger.Debug("pass approval to service")
+		redirect, err = h.service.Approve(r.Context(), req, r.PostForm.Get("login"), r.PostForm.Get("password"))
+	} else {
+		logger.Debug("pass denial to service")
+		redirect, err = h.service.Deny(r.Context(), req)
+	}
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_token" {
+			client, scopes, vErr := h.service.ValidateAuthorizeRequest(r.Context(), req)
+			if vErr == nil {
+				return h.renderConsent(w, r, http.StatusUnauthorized, client, scopes, req, "Wrong login or password")
+			}
+		}
+		return h.authorizeError(w, r, req, err)
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+	return nil
+}
+
+func (h *OAuthHandler) tokenHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle token request")
+	if err := r.ParseForm(); err != nil {
+		logger.Debugf("error during parsing form: %v", err)
+		return errInvalidRequest(err.Error())
+	}
+	clientId, clientSecret := clientCredentials(r)
+	req := TokenRequestDTO{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectUri:  r.PostForm.Get("redirect_uri"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+	logger.Debug("pass token request to service")
+	token, err := h.service.Exchange(r.Context(), req)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return writeJson(w, http.StatusOK, token)
+}
+
+func (h *OAuthHandler) introspectHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle introspect request")
+	if err := r.ParseForm(); err != nil {
+		logger.Debugf("error during parsing form: %v", err)
+		return errInvalidRequest(err.Error())
+	}
+	clientId, clientSecret := clientCredentials(r)
+	logger.Debug("pass token to service")
+	info, err := h.service.Introspect(r.Context(), clientId, clientSecret, r.PostForm.Get("token"))
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	return writeJson(w, http.StatusOK, info)
+}
+
+func (h *OAuthHandler) revokeHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle revoke request")
+	if err := r.ParseForm(); err != nil {
+		logger.Debugf("error during parsing form: %v", err)
+		return errInvalidRequest(err.Error())
+	}
+	clientId, clientSecret := clientCredentials(r)
+	logger.Debug("pass token to service")
+	if err := h.service.Revoke(r.Context(), clientId, clientSecret, r.PostForm.Get("token")); err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *OAuthHandler) renderConsent(w http.ResponseWriter, r *http.Request, status int, client Client,
+	scopes []string, req AuthorizeRequestDTO, errMsg string) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	return consentTemplate.Execute(w, consentPage{
+		Client: client,
+		Scopes: scopes,
+		Params: map[string]string{
+			"response_type":         req.ResponseType,
+			"client_id":             req.ClientId,
+			"redirect_uri":          req.RedirectUri,
+			"scope":                 req.Scope,
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+		},
+		Login: signedInLogin(r.Context()),
+		Error: errMsg,
+	})
+}
+
+// authorizeError redirects error back to client when redirect uri is
+// trusted, otherwise the error is shown to user.
+func (h *OAuthHandler) authorizeError(w http.ResponseWriter, r *http.Request, req AuthorizeRequestDTO, err error) error {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.untrusted {
+		return err
+	}
+	http.Redirect(w, r, redirectWith(req.RedirectUri, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+		"state":             {req.State},
+	}), http.StatusFound)
+	return nil
+}
+
+func authorizeRequestFromValues(values url.Values) AuthorizeRequestDTO {
+	return AuthorizeRequestDTO{
+		ResponseType:        values.Get("response_type"),
+		ClientId:            values.Get("client_id"),
+		RedirectUri:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+func clientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+	return nil
+}
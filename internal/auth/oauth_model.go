@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+)
+
+var supportedScopes = []string{ScopeNotesRead, ScopeNotesWrite}
+
+type Client struct {
+	Id           string    `json:"id"`
+	SecretHash   string    `json:"secret_hash,omitempty"`
+	Name         string    `json:"name"`
+	RedirectUris []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Owner        string    `json:"owner"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// IsPublic reports whether client can not keep secret (e.g. native or
+// browser app) and is authenticated by PKCE only.
+func (c *Client) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+func (c *Client) CheckSecret(secret string) bool {
+	if c.IsPublic() {
+		return secret == ""
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret)) == nil
+}
+
+func (c *Client) HasRedirectUri(uri string) bool {
+	for _, u := range c.RedirectUris {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedScopes returns requested scopes if all of them are granted to
+// client, empty request means all scopes of client.
+func (c *Client) AllowedScopes(requested []string) ([]string, bool) {
+	if len(requested) == 0 {
+		return c.Scopes, true
+	}
+	for _, s := range requested {
+		if !containsScope(c.Scopes, s) {
+			return nil, false
+		}
+	}
+	return requested, true
+}
+
+// AuthorizationCode is grant of user's consent, which client exchanges for
+// access token once.
+type AuthorizationCode struct {
+	ClientId      string    `json:"client_id"`
+	RedirectUri   string    `json:"redirect_uri"`
+	Login         string    `json:"login"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func parseScopes(scope string) []string {
+	return strings.Fields(scope)
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ OAuthService = &oauthService{}
+
+const (
+	authorizationCodeTTL = time.Minute
+	accessTokenTTL       = time.Hour
+)
+
+type OAuthService interface {
+	RegisterClient(ctx context.Context, dto RegisterClientDTO) (ClientDTO, error)
+	ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequestDTO) (Client, []string, error)
+	Approve(ctx context.Context, req AuthorizeRequestDTO, login string, password string) (string, error)
+	Deny(ctx context.Context, req AuthorizeRequestDTO) (string, error)
+	Exchange(ctx context.Context, req TokenRequestDTO) (TokenDTO, error)
+	Introspect(ctx context.Context, clientId string, clientSecret string, token string) (IntrospectionDTO, error)
+	Revoke(ctx context.Context, clientId string, clientSecret string, token string) error
+}
+
+type oauthService struct {
+	authSrv     Service
+	clients     ClientStorage
+	credentials CredentialsChecker
+	logger      *logrus.Logger
+}
+
+func NewOAuthService(authSrv Service, clients ClientStorage, credentials CredentialsChecker,
+	logger *logrus.Logger) OAuthService {
+	return &oauthService{
+		authSrv:     authSrv,
+		clients:     clients,
+		credentials: credentials,
+		logger:      logger,
+	}
+}
+
+func (s oauthService) RegisterClient(ctx context.Context, dto RegisterClientDTO) (ClientDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("register oauth client")
+	logger.Debug("authorize request")
+	principal, err := Authorize(ctx)
+	if err != nil {
+		logger.Debugf("error during authorization: %v", err)
+		return ClientDTO{}, errUnauthorized(err.Error())
+	}
+	logger.Debug("validate client")
+	if strings.TrimSpace(dto.Name) == "" {
+		return ClientDTO{}, errInvalidRequest("client name is required")
+	}
+	if len(dto.RedirectUris) == 0 {
+		return ClientDTO{}, errInvalidRequest("at least one redirect uri is required")
+	}
+	for _, uri := range dto.RedirectUris {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return ClientDTO{}, errInvalidRequest(fmt.Sprintf("redirect uri must be absolute uri without fragment: %q", uri))
+		}
+	}
+	scopes := dto.Scopes
+	if len(scopes) == 0 {
+		scopes = supportedScopes
+	}
+	for _, scope := range scopes {
+		if !containsScope(supportedScopes, scope) {
+			return ClientDTO{}, errInvalidScope(fmt.Sprintf("unsupported scope %q", scope))
+		}
+	}
+	logger.Debug("generate client credentials")
+	clientId, err := randomToken(16)
+	if err != nil {
+		return ClientDTO{}, err
+	}
+	client := Client{
+		Id:           clientId,
+		Name:         dto.Name,
+		RedirectUris: dto.RedirectUris,
+		Scopes:       scopes,
+		Owner:        principal.Login,
+		CreatedAt:    time.Now(),
+	}
+	var secret string
+	if !dto.Public {
+		if secret, err = randomToken(32); err != nil {
+			return ClientDTO{}, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return ClientDTO{}, err
+		}
+		client.SecretHash = string(hash)
+	}
+	logger.Debug("pass client to storage to save it")
+	if err = s.clients.Save(ctx, client); err != nil {
+		logger.Debugf("error during saving client: %v", err)
+		return ClientDTO{}, err
+	}
+	return ClientDTO{
+		ClientId:     client.Id,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectUris: client.RedirectUris,
+		Scopes:       client.Scopes,
+	}, nil
+}
+
+func (s oauthService) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequestDTO) (Client, []string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("validate authorization request")
+	logger.Debug("get client")
+	client, err := s.clients.GetById(ctx, req.ClientId)
+	if err != nil {
+		logger.Debugf("error during getting client: %v", err)
+		return Client{}, nil, errInvalidClient("unknown client")
+	}
+	if !client.HasRedirectUri(req.RedirectUri) {
+		logger.Debugf("redirect uri %q is not registered", req.RedirectUri)
+		return Client{}, nil, errInvalidRedirectUri("redirect uri is not registered for client")
+	}
+	if req.ResponseType != "code" {
+		return client, nil, newOAuthError(400, "unsupported_response_type", "only code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return client, nil, errInvalidRequest("PKCE with S256 code challenge is required")
+	}
+	scopes, ok := client.AllowedScopes(parseScopes(req.Scope))
+	if !ok {
+		return client, nil, errInvalidScope("requested scope is not allowed for client")
+	}
+	return client, scopes, nil
+}
+
+func (s oauthService) Approve(ctx context.Context, req AuthorizeRequestDTO, login string, password string) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("approve authorization request")
+	client, scopes, err := s.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("authenticate user")
+	if login, err = s.authenticateUser(ctx, login, password); err != nil {
+		return "", err
+	}
+	logger.Debug("generate authorization code")
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("pass authorization code to storage to save it")
+	err = s.clients.SaveCode(ctx, code, AuthorizationCode{
+		ClientId:      client.Id,
+		RedirectUri:   req.RedirectUri,
+		Login:         login,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		logger.Debugf("error during saving authorization code: %v", err)
+		return "", err
+	}
+	return redirectWith(req.RedirectUri, url.Values{"code": {code}, "state": {req.State}}), nil
+}
+
+func (s oauthService) Deny(ctx context.Context, req AuthorizeRequestDTO) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("deny authorization request")
+	if _, _, err := s.ValidateAuthorizeRequest(ctx, req); err != nil {
+		return "", err
+	}
+	return redirectWith(req.RedirectUri, url.Values{
+		"error":             {"access_denied"},
+		"error_description": {"user denied access"},
+		"state":             {req.State},
+	}), nil
+}
+
+func (s oauthService) Exchange(ctx context.Context, req TokenRequestDTO) (TokenDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("exchange authorization code")
+	if req.GrantType != "authorization_code" {
+		return TokenDTO{}, newOAuthError(400, "unsupported_grant_type", "only authorization_code grant is supported")
+	}
+	client, err := s.authenticateClient(ctx, req.ClientId, req.ClientSecret)
+	if err != nil {
+		return TokenDTO{}, err
+	}
+	logger.Debug("take authorization code")
+	code, err := s.clients.TakeCode(ctx, req.Code)
+	if errors.Is(err, problem.NotFound) || err == nil && time.Now().After(code.ExpiresAt) {
+		logger.Debug("unknown or expired code")
+		return TokenDTO{}, errInvalidGrant("unknown or expired authorization code")
+	} else if err != nil {
+		logger.Debugf("error during taking authorization code: %v", err)
+		return TokenDTO{}, err
+	}
+	if code.ClientId != client.Id || code.RedirectUri != req.RedirectUri {
+		logger.Debug("code was issued for another client or redirect uri")
+		return TokenDTO{}, errInvalidGrant("authorization code was issued for another client")
+	}
+	logger.Debug("check code verifier")
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(code.CodeChallenge)) != 1 {
+		logger.Debug("code verifier mismatch")
+		return TokenDTO{}, errInvalidGrant("code verifier does not match code challenge")
+	}
+	logger.Debug("generate access token")
+	token, err := s.authSrv.GenerateAccessToken(ctx, code.Login, client.Id, code.Scopes, accessTokenTTL)
+	if err != nil {
+		return TokenDTO{}, err
+	}
+	return TokenDTO{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(accessTokenTTL.Seconds()),
+		Scope:       strings.Join(code.Scopes, " "),
+	}, nil
+}
+
+func (s oauthService) Introspect(ctx context.Context, clientId string, clientSecret string,
+	token string) (IntrospectionDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("introspect token")
+	client, err := s.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return IntrospectionDTO{}, err
+	}
+	if client.IsPublic() {
+		logger.Debug("public client can not introspect tokens")
+		return IntrospectionDTO{}, errInvalidClient("only confidential clients may introspect tokens")
+	}
+	claims, err := s.authSrv.ParseTokenClaims(ctx, token)
+	if err != nil {
+		logger.Debugf("token is not active: %v", err)
+		return IntrospectionDTO{Active: false}, nil
+	}
+	if claims.ClientId != client.Id {
+		logger.Debug("token was issued for another client")
+		return IntrospectionDTO{Active: false}, nil
+	}
+	dto := IntrospectionDTO{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		Username:  claims.UserLogin,
+		TokenType: "Bearer",
+		Sub:       claims.UserLogin,
+		Jti:       claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		dto.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		dto.Iat = claims.IssuedAt.Unix()
+	}
+	return dto, nil
+}
+
+func (s oauthService) Revoke(ctx context.Context, clientId string, clientSecret string, token string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("revoke token")
+	client, err := s.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return err
+	}
+	claims, err := s.authSrv.ParseTokenClaims(ctx, token)
+	if err != nil {
+		logger.Debugf("token is already invalid: %v", err)
+		return nil
+	}
+	if claims.ClientId != client.Id {
+		logger.Debug("token was issued for another client")
+		return nil
+	}
+	return s.authSrv.RevokeToken(ctx, claims)
+}
+
+func (s oauthService) authenticateClient(ctx context.Context, clientId string, clientSecret string) (Client, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("authenticate client")
+	client, err := s.clients.GetById(ctx, clientId)
+	if err != nil {
+		logger.Debugf("error during getting client: %v", err)
+		return Client{}, errInvalidClient("unknown client")
+	}
+	if !client.CheckSecret(clientSecret) {
+		logger.Debug("wrong client secret")
+		return Client{}, errInvalidClient("wrong client credentials")
+	}
+	return client, nil
+}
+
+// authenticateUser returns login of user giving consent. Signed in user
+// needs no password, so that users without one (e.g. signed in with oidc)
+// may consent.
+func (s oauthService) authenticateUser(ctx context.Context, login string, password string) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	if signedIn := signedInLogin(ctx); signedIn != "" {
+		logger.Debug("user is signed in")
+		return signedIn, nil
+	}
+	logger.Debug("check user's credentials")
+	login, err := s.credentials.CheckCredentials(ctx, login, password)
+	if err != nil {
+		logger.Debugf("wrong credentials: %v", err)
+		return "", errUnauthorized("wrong login or password")
+	}
+	return login, nil
+}
+
+// signedInLogin returns login of user authorized by bearer token of
+// session. Principals of client certificates are not accepted, since
+// browsers send certificates with forged consent forms as well.
+func signedInLogin(ctx context.Context) string {
+	p, err := Authorize(ctx)
+	if err != nil || p.SessionId == "" {
+		return ""
+	}
+	return p.Login
+}
+
+func redirectWith(redirectUri string, params url.Values) string {
+	u, _ := url.Parse(redirectUri)
+	query := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			query[k] = v
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testRedirectUri = "https://client.example/callback"
+	testVerifier    = "verifier-verifier-verifier-verifier-verifier"
+)
+
+// noCredentials rejects every password, as for users signed in with oidc.
+type noCredentials struct{}
+
+func (noCredentials) CheckCredentials(ctx context.Context, login string, password string) (string, error) {
+	return "", problem.WrongCredentials
+}
+
+func newTestOAuthService(t *testing.T) (auth.OAuthService, auth.ClientStorage) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients := storage.NewInMemoryStorage(logger)
+	authSrv := auth.NewAuthService(storage.NewInMemorySessionStorage(logger), logger)
+	return auth.NewOAuthService(authSrv, clients, noCredentials{}, logger), clients
+}
+
+func signedIn(login string) context.Context {
+	return auth.WithPrincipal(context.Background(), auth.Principal{Login: login, SessionId: "session-1"})
+}
+
+func authorizeRequest(t *testing.T, s auth.OAuthService) auth.AuthorizeRequestDTO {
+	t.Helper()
+	client, err := s.RegisterClient(signedIn("owner"), auth.RegisterClientDTO{
+		Name:         "client",
+		RedirectUris: []string{testRedirectUri},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatalf("register client: %v", err)
+	}
+	challenge := sha256.Sum256([]byte(testVerifier))
+	return auth.AuthorizeRequestDTO{
+		ResponseType:        "code",
+		ClientId:            client.ClientId,
+		RedirectUri:         testRedirectUri,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func codeOf(t *testing.T, redirect string) string {
+	t.Helper()
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	code := u.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %q", redirect)
+	}
+	return code
+}
+
+func TestApprove(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantError bool
+	}{
+		{name: "signed in user needs no password", ctx: signedIn("alice")},
+		{name: "anonymous user is checked by credentials", ctx: context.Background(), wantError: true},
+		{
+			name:      "certificate principal is checked by credentials",
+			ctx:       auth.WithPrincipal(context.Background(), auth.Principal{Login: "alice"}),
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestOAuthService(t)
+			req := authorizeRequest(t, s)
+			_, err := s.Approve(tt.ctx, req, "alice", "")
+			if tt.wantError != (err != nil) {
+				t.Errorf("error = %v, want error %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestExchange_CodeIsSingleUse(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	req := authorizeRequest(t, s)
+	redirect, err := s.Approve(signedIn("alice"), req, "", "")
+	if err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	tokenReq := auth.TokenRequestDTO{
+		GrantType:    "authorization_code",
+		Code:         codeOf(t, redirect),
+		RedirectUri:  testRedirectUri,
+		ClientId:     req.ClientId,
+		CodeVerifier: testVerifier,
+	}
+	if _, err = s.Exchange(context.Background(), tokenReq); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	var oauthErr *auth.OAuthError
+	if _, err = s.Exchange(context.Background(), tokenReq); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Errorf("second exchange error = %v, want invalid_grant", err)
+	}
+}
+
+func TestTakeCode(t *testing.T) {
+	_, clients := newTestOAuthService(t)
+	ctx := context.Background()
+	if err := clients.SaveCode(ctx, "expired", auth.AuthorizationCode{ExpiresAt: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatalf("save code: %v", err)
+	}
+	if _, err := clients.TakeCode(ctx, "expired"); !errors.Is(err, problem.NotFound) {
+		t.Errorf("expired code error = %v, want not found", err)
+	}
+
+	if err := clients.SaveCode(ctx, "code", auth.AuthorizationCode{ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatalf("save code: %v", err)
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		taken int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := clients.TakeCode(ctx, "code"); err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.Errorf("code taken %d times, want once", taken)
+	}
+}
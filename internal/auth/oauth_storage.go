@@ -0,0 +1,21 @@
+package auth
+
+import "context"
+
+type ClientStorage interface {
+	Save(ctx context.Context, client Client) error
+	GetById(ctx context.Context, id string) (Client, error)
+	// SaveCode stores authorization code until it expires.
+	SaveCode(ctx context.Context, code string, ac AuthorizationCode) error
+	// TakeCode returns authorization code and deletes it atomically, so that
+	// code is redeemed once. Unknown and expired codes are problem.NotFound.
+	TakeCode(ctx context.Context, code string) (AuthorizationCode, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// CredentialsChecker checks user's credentials and returns login of the
+// user they belong to.
+type CredentialsChecker interface {
+	CheckCredentials(ctx context.Context, login string, password string) (string, error)
+}
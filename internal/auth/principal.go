@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+)
+
+// Principal is the authenticated caller on whose behalf an operation is
+// performed. Principals of third-party clients have ClientId and are limited
+// by Scopes.
+type Principal struct {
+	Login     string
+	Roles     []string
+	Scopes    []string
+	SessionId string
+	ClientId  string
+}
+
+func (p Principal) IsThirdParty() bool {
+	return p.ClientId != ""
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return !p.IsThirdParty() || containsScope(p.Scopes, scope)
+}
+
+func newPrincipal(claims *UserClaims) Principal {
+	return Principal{
+		Login:     claims.UserLogin,
+		Roles:     claims.Roles,
+		Scopes:    parseScopes(claims.Scope),
+		SessionId: claims.SessionId,
+		ClientId:  claims.ClientId,
+	}
+}
+
+type authenticationKey struct{}
+
+// authentication is the outcome of authenticating credentials of a request,
+// err is kept so that it is reported only by operations requiring a principal.
+type authentication struct {
+	principal Principal
+	err       error
+}
+
+// WithPrincipal returns context of operations performed on behalf of p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, authenticationKey{}, authentication{principal: p})
+}
+
+func withAuthenticationError(ctx context.Context, err error) context.Context {
+	return context.WithValue(ctx, authenticationKey{}, authentication{err: err})
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	a, ok := ctx.Value(authenticationKey{}).(authentication)
+	return a.principal, ok && a.err == nil
+}
+
+// Authorize returns principal of ctx, principals of third-party clients are
+// rejected.
+func Authorize(ctx context.Context) (Principal, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return Principal{}, err
+	}
+	if p.IsThirdParty() {
+		return Principal{}, problem.Forbidden.WithDetail("token of third-party client is not allowed for this operation")
+	}
+	return p, nil
+}
+
+// AuthorizeScope is like Authorize but also accepts principals of
+// third-party clients granted the scope.
+func AuthorizeScope(ctx context.Context, scope string) (Principal, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return Principal{}, err
+	}
+	if !p.HasScope(scope) {
+		return Principal{}, problem.Forbidden.WithDetail(fmt.Sprintf("token has no scope %s", scope))
+	}
+	return p, nil
+}
+
+func principal(ctx context.Context) (Principal, error) {
+	a, ok := ctx.Value(authenticationKey{}).(authentication)
+	if !ok {
+		return Principal{}, problem.Unauthorized.WithDetail("authorization is required")
+	}
+	if a.err != nil {
+		return Principal{}, a.err
+	}
+	return a.principal, nil
+}
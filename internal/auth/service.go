@@ -2,8 +2,13 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
@@ -11,33 +16,105 @@ var _ Service = &service{}
 
 var secret = []byte("smboniudrou5wghius")
 
+const (
+	tokenTTL            = 8 * time.Hour
+	lastSeenInterval    = time.Minute
+	verificationPurpose = "verify_email"
+)
+
 type Service interface {
-	GenerateToken(ctx context.Context, login string) (string, error)
+	GenerateToken(ctx context.Context, login string, roles []string) (string, error)
 	ParseToken(ctx context.Context, token string) (string, error)
+	GenerateVerificationToken(ctx context.Context, login string, email string, ttl time.Duration) (string, error)
+	ParseVerificationToken(ctx context.Context, token string) (string, string, error)
+	RevokeTokens(ctx context.Context, login string) error
+	DeleteSessions(ctx context.Context, login string) error
+	GenerateAccessToken(ctx context.Context, login string, clientId string, scopes []string, ttl time.Duration) (string, error)
+	ParseTokenClaims(ctx context.Context, token string) (*UserClaims, error)
+	RevokeToken(ctx context.Context, claims *UserClaims) error
+	ListSessions(ctx context.Context, login string) (Sessions, error)
+	RevokeSession(ctx context.Context, id string) error
+	CheckKey(ctx context.Context) error
 }
 
+// UserClaims are claims of service's tokens. Tokens issued to third-party
+// clients have ClientId and are limited by Scope.
 type UserClaims struct {
 	jwt.RegisteredClaims
-	UserLogin string `json:"user_login"`
+	UserLogin string   `json:"user_login"`
+	Purpose   string   `json:"purpose,omitempty"`
+	ClientId  string   `json:"client_id,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionId string   `json:"sid,omitempty"`
+	// Email is the address verification token was sent to.
+	Email string `json:"email,omitempty"`
+}
+
+func (c *UserClaims) IsThirdParty() bool {
+	return c.ClientId != ""
+}
+
+func (c *UserClaims) HasScope(scope string) bool {
+	return !c.IsThirdParty() || containsScope(parseScopes(c.Scope), scope)
 }
 
+// service keeps no state of its own: every token references a session in
+// storage and is revoked together with it, so that revocations survive
+// restarts and are shared by all instances.
 type service struct {
-	logger *logrus.Logger
+	sessions SessionStorage
+	logger   *logrus.Logger
 }
 
-func NewAuthService(logger *logrus.Logger) Service {
+func NewAuthService(sessions SessionStorage, logger *logrus.Logger) Service {
 	return &service{
-		logger: logger,
+		sessions: sessions,
+		logger:   logger,
+	}
+}
+
+// createSession saves session for a new token of login, clientId is empty
+// for first-party tokens.
+func (s service) createSession(ctx context.Context, login string, clientId string, ttl time.Duration) (Session, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("create session")
+	sid, err := randomToken(16)
+	if err != nil {
+		return Session{}, err
+	}
+	now := time.Now()
+	client := ClientInfoFromContext(ctx)
+	session := Session{
+		Id:         sid,
+		Login:      login,
+		ClientId:   clientId,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+		Ip:         client.Ip,
+		UserAgent:  client.UserAgent,
+	}
+	if err = s.sessions.Save(ctx, session); err != nil {
+		logger.Debugf("error during saving session: %v", err)
+		return Session{}, err
 	}
+	return session, nil
 }
 
-func (s service) GenerateToken(ctx context.Context, login string) (string, error) {
+func (s service) GenerateToken(ctx context.Context, login string, roles []string) (string, error) {
+	session, err := s.createSession(ctx, login, "", tokenTTL)
+	if err != nil {
+		return "", err
+	}
 	claims := UserClaims{
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(8 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(session.CreatedAt),
 		},
-		login,
+		UserLogin: login,
+		Roles:     roles,
+		SessionId: session.Id,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	ss, err := token.SignedString(secret)
@@ -45,18 +122,222 @@ func (s service) GenerateToken(ctx context.Context, login string) (string, error
 }
 
 func (s service) ParseToken(ctx context.Context, tokenStr string) (string, error) {
-	s.logger.Tracef("got token to parse: %q", tokenStr)
+	claims, err := s.ParseTokenClaims(ctx, tokenStr)
+	if err != nil {
+		return "", err
+	}
+	return claims.UserLogin, nil
+}
+
+func (s service) GenerateAccessToken(ctx context.Context, login string, clientId string, scopes []string,
+	ttl time.Duration) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	session, err := s.createSession(ctx, login, clientId, ttl)
+	if err != nil {
+		return "", err
+	}
+	claims := UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   login,
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(session.CreatedAt),
+		},
+		UserLogin: login,
+		ClientId:  clientId,
+		Scope:     strings.Join(scopes, " "),
+		SessionId: session.Id,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	ss, err := token.SignedString(secret)
+	return ss, err
+}
+
+func (s service) ParseTokenClaims(ctx context.Context, tokenStr string) (*UserClaims, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Tracef("got token to parse: %q", tokenStr)
+	claims, err := s.parseClaims(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		logger.Debugf("token with purpose %q can not be used for auth", claims.Purpose)
+		return nil, fmt.Errorf("token can not be used for auth")
+	}
+	if claims.SessionId == "" {
+		logger.Debug("token has no session and can not be revoked")
+		return nil, fmt.Errorf("token has no session")
+	}
+	if err = s.checkSession(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkSession rejects tokens of revoked sessions and updates last seen
+// time of active ones.
+func (s service) checkSession(ctx context.Context, claims *UserClaims) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("check token's session")
+	session, err := s.sessions.GetById(ctx, claims.SessionId)
+	if err != nil {
+		logger.Debugf("error during getting session: %v", err)
+		return fmt.Errorf("session was revoked")
+	}
+	now := time.Now()
+	if !session.IsActive(now) || session.Login != claims.UserLogin || session.ClientId != claims.ClientId {
+		logger.Debugf("session %s was revoked", session.Id)
+		return fmt.Errorf("session was revoked")
+	}
+	if now.Sub(session.LastSeenAt) < lastSeenInterval {
+		return nil
+	}
+	logger.Debug("update session's last seen time")
+	session.LastSeenAt = now
+	if client := ClientInfoFromContext(ctx); client.Ip != "" {
+		session.Ip = client.Ip
+	}
+	if err = s.sessions.Update(ctx, session); err != nil {
+		logger.Warnf("error during updating session: %v", err)
+	}
+	return nil
+}
+
+// ListSessions returns sessions of login which are not expired yet,
+// including revoked ones.
+func (s service) ListSessions(ctx context.Context, login string) (Sessions, error) {
+	return s.sessions.GetAllByLogin(ctx, login)
+}
+
+func (s service) RevokeSession(ctx context.Context, id string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infof("revoke session %s", id)
+	session, err := s.sessions.GetById(ctx, id)
+	if err != nil {
+		logger.Debugf("error during getting session: %v", err)
+		return err
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	return s.sessions.Update(ctx, session)
+}
+
+// RevokeToken revokes session of the token, so that the token is rejected
+// by every instance of the service.
+func (s service) RevokeToken(ctx context.Context, claims *UserClaims) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infof("revoke token %s", claims.ID)
+	return s.RevokeSession(ctx, claims.SessionId)
+}
+
+func (s service) RevokeTokens(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infof("revoke tokens of %q", login)
+	logger.Debug("revoke sessions")
+	sessions, err := s.sessions.GetAllByLogin(ctx, login)
+	if err != nil {
+		logger.Debugf("error during getting sessions: %v", err)
+		return err
+	}
+	for _, session := range sessions {
+		if session.RevokedAt != nil {
+			continue
+		}
+		now := time.Now()
+		session.RevokedAt = &now
+		if err = s.sessions.Update(ctx, session); err != nil {
+			logger.Debugf("error during updating session: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSessions drops all sessions of login, tokens referencing them are
+// rejected since then.
+func (s service) DeleteSessions(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infof("delete sessions of %q", login)
+	return s.sessions.DeleteAllByLogin(ctx, login)
+}
+
+// CheckKey checks that signing key is loaded and tokens signed with it can
+// be verified.
+func (s service) CheckKey(ctx context.Context) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("signing key is not loaded")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	ss, err := token.SignedString(secret)
+	if err != nil {
+		return err
+	}
+	_, err = jwt.ParseWithClaims(ss, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	return err
+}
+
+func (s service) GenerateVerificationToken(ctx context.Context, login string, email string,
+	ttl time.Duration) (string, error) {
+	claims := UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		UserLogin: login,
+		Purpose:   verificationPurpose,
+		Email:     email,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	ss, err := token.SignedString(secret)
+	return ss, err
+}
+
+// ParseVerificationToken returns login and email the token was issued for.
+func (s service) ParseVerificationToken(ctx context.Context, tokenStr string) (string, string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Tracef("got verification token to parse: %q", tokenStr)
+	claims, err := s.parseClaims(ctx, tokenStr)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Purpose != verificationPurpose {
+		logger.Debugf("token purpose %q is not %q", claims.Purpose, verificationPurpose)
+		return "", "", fmt.Errorf("token is not a verification token")
+	}
+	return claims.UserLogin, claims.Email, nil
+}
+
+func (s service) parseClaims(ctx context.Context, tokenStr string) (*UserClaims, error) {
+	logger := logging.FromContext(ctx, s.logger)
 	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{},
 		func(token *jwt.Token) (interface{}, error) {
 			return secret, nil
 		})
 	if err != nil {
-		s.logger.Debugf("error during parsing token: %v", err)
-		return "", err
+		logger.Debugf("error during parsing token: %v", err)
+		return nil, err
+	}
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims.UserLogin, nil
-	} else {
+	return claims, nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
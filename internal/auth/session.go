@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Session is created on every sign in and for every access token issued to
+// third-party client, it is referenced by "sid" claim of the token issued
+// for it. Revoked session makes its token invalid.
+type Session struct {
+	Id         string     `json:"id"`
+	Login      string     `json:"login"`
+	ClientId   string     `json:"client_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Ip         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type Sessions = []Session
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// ClientInfo describes client the request came from.
+type ClientInfo struct {
+	Ip        string
+	UserAgent string
+}
+
+func NewClientInfo(r *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return ClientInfo{
+		Ip:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+type clientInfoKey struct{}
+
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
@@ -0,0 +1,13 @@
+package auth
+
+import "context"
+
+type SessionStorage interface {
+	Save(ctx context.Context, session Session) error
+	GetById(ctx context.Context, id string) (Session, error)
+	GetAllByLogin(ctx context.Context, login string) (Sessions, error)
+	Update(ctx context.Context, session Session) error
+	DeleteAllByLogin(ctx context.Context, login string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ auth.SessionStorage = &inMemorySessionStorage{}
+
+type inMemorySessionStorage struct {
+	sync.Mutex
+	logger *logrus.Logger
+
+	sessions map[string]auth.Session
+}
+
+func NewInMemorySessionStorage(logger *logrus.Logger) auth.SessionStorage {
+	ims := &inMemorySessionStorage{}
+	ims.logger = logger
+	ims.sessions = make(map[string]auth.Session)
+	return ims
+}
+
+func (ims *inMemorySessionStorage) Save(ctx context.Context, session auth.Session) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("save session to in_memory_storage")
+	logger.Debug("drop expired sessions")
+	now := time.Now()
+	for id, s := range ims.sessions {
+		if !now.Before(s.ExpiresAt) {
+			delete(ims.sessions, id)
+		}
+	}
+	ims.sessions[session.Id] = session
+	logger.Debug("session was saved")
+	return nil
+}
+
+func (ims *inMemorySessionStorage) GetById(ctx context.Context, id string) (auth.Session, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get session from in_memory_storage")
+	logger.Debugf("find session by id: %s", id)
+	session, ok := ims.sessions[id]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		logger.Debugf("session was not found, id: %s", id)
+		return auth.Session{}, fmt.Errorf("session with id '%s' not found", id)
+	}
+	return session, nil
+}
+
+func (ims *inMemorySessionStorage) GetAllByLogin(ctx context.Context, login string) (auth.Sessions, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get user's sessions from in_memory_storage")
+	sessions := auth.Sessions{}
+	now := time.Now()
+	for _, s := range ims.sessions {
+		if s.Login == login && now.Before(s.ExpiresAt) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	logger.Debugf("found %d sessions", len(sessions))
+	return sessions, nil
+}
+
+func (ims *inMemorySessionStorage) Update(ctx context.Context, session auth.Session) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("update session in in_memory_storage")
+	if _, ok := ims.sessions[session.Id]; !ok {
+		logger.Debugf("session was not found, id: %s", session.Id)
+		return fmt.Errorf("session with id '%s' not found", session.Id)
+	}
+	ims.sessions[session.Id] = session
+	logger.Debug("session was updated")
+	return nil
+}
+
+func (ims *inMemorySessionStorage) DeleteAllByLogin(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("delete user's sessions from in_memory_storage")
+	for id, s := range ims.sessions {
+		if s.Login == login {
+			delete(ims.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (ims *inMemorySessionStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ims *inMemorySessionStorage) Close() error {
+	ims.logger.Info("close session in_memory_storage")
+	return nil
+}
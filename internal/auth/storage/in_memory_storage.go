@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+var _ auth.ClientStorage = &inMemoryStorage{}
+
+type inMemoryStorage struct {
+	sync.Mutex
+	logger *logrus.Logger
+
+	clients map[string]auth.Client
+	codes   map[string]auth.AuthorizationCode
+}
+
+func NewInMemoryStorage(logger *logrus.Logger) auth.ClientStorage {
+	ims := &inMemoryStorage{}
+	ims.logger = logger
+	ims.clients = make(map[string]auth.Client)
+	ims.codes = make(map[string]auth.AuthorizationCode)
+	return ims
+}
+
+func (ims *inMemoryStorage) Save(ctx context.Context, client auth.Client) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("save oauth client to in_memory_storage")
+	ims.clients[client.Id] = client
+	logger.Debug("oauth client was saved")
+	return nil
+}
+
+func (ims *inMemoryStorage) GetById(ctx context.Context, id string) (auth.Client, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get oauth client from in_memory_storage")
+	logger.Debugf("find oauth client by id: %s", id)
+	client, ok := ims.clients[id]
+	if !ok {
+		logger.Debugf("oauth client was not found, id: %s", id)
+		return auth.Client{}, fmt.Errorf("oauth client with id '%s' not found", id)
+	}
+	logger.Debug("oauth client found")
+	return client, nil
+}
+
+func (ims *inMemoryStorage) SaveCode(ctx context.Context, code string, ac auth.AuthorizationCode) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("save authorization code to in_memory_storage")
+	logger.Debug("delete expired authorization codes")
+	now := time.Now()
+	for c, stored := range ims.codes {
+		if now.After(stored.ExpiresAt) {
+			delete(ims.codes, c)
+		}
+	}
+	ims.codes[code] = ac
+	logger.Debug("authorization code was saved")
+	return nil
+}
+
+func (ims *inMemoryStorage) TakeCode(ctx context.Context, code string) (auth.AuthorizationCode, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("take authorization code from in_memory_storage")
+	ac, ok := ims.codes[code]
+	delete(ims.codes, code)
+	if !ok || time.Now().After(ac.ExpiresAt) {
+		logger.Debug("authorization code was not found")
+		return auth.AuthorizationCode{}, problem.NotFound.WithDetail("authorization code not found")
+	}
+	logger.Debug("authorization code taken")
+	return ac, nil
+}
+
+func (ims *inMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ims *inMemoryStorage) Close() error {
+	ims.logger.Info("close oauth client in_memory_storage")
+	return nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+var _ auth.SessionStorage = &instrumentedSessionStorage{}
+
+// instrumentedSessionStorage records latency and spans of operations of wrapped storage.
+type instrumentedSessionStorage struct {
+	storage auth.SessionStorage
+	backend string
+}
+
+func NewInstrumentedSessionStorage(storage auth.SessionStorage, backend string) auth.SessionStorage {
+	return &instrumentedSessionStorage{
+		storage: storage,
+		backend: backend,
+	}
+}
+
+func (is *instrumentedSessionStorage) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, "session storage "+method,
+		attribute.String("storage.backend", is.backend))
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveStorage("session", is.backend, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (is *instrumentedSessionStorage) Save(ctx context.Context, session auth.Session) error {
+	ctx, done := is.start(ctx, "Save")
+	err := is.storage.Save(ctx, session)
+	done(err)
+	return err
+}
+
+func (is *instrumentedSessionStorage) GetById(ctx context.Context, id string) (auth.Session, error) {
+	ctx, done := is.start(ctx, "GetById")
+	session, err := is.storage.GetById(ctx, id)
+	done(err)
+	return session, err
+}
+
+func (is *instrumentedSessionStorage) GetAllByLogin(ctx context.Context, login string) (auth.Sessions, error) {
+	ctx, done := is.start(ctx, "GetAllByLogin")
+	sessions, err := is.storage.GetAllByLogin(ctx, login)
+	done(err)
+	return sessions, err
+}
+
+func (is *instrumentedSessionStorage) Update(ctx context.Context, session auth.Session) error {
+	ctx, done := is.start(ctx, "Update")
+	err := is.storage.Update(ctx, session)
+	done(err)
+	return err
+}
+
+func (is *instrumentedSessionStorage) DeleteAllByLogin(ctx context.Context, login string) error {
+	ctx, done := is.start(ctx, "DeleteAllByLogin")
+	err := is.storage.DeleteAllByLogin(ctx, login)
+	done(err)
+	return err
+}
+
+func (is *instrumentedSessionStorage) Ping(ctx context.Context) error {
+	ctx, done := is.start(ctx, "Ping")
+	err := is.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (is *instrumentedSessionStorage) Close() error {
+	return is.storage.Close()
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+var _ auth.ClientStorage = &instrumentedStorage{}
+
+// instrumentedStorage records latency and spans of operations of wrapped storage.
+type instrumentedStorage struct {
+	storage auth.ClientStorage
+	backend string
+}
+
+func NewInstrumentedStorage(storage auth.ClientStorage, backend string) auth.ClientStorage {
+	return &instrumentedStorage{
+		storage: storage,
+		backend: backend,
+	}
+}
+
+func (is *instrumentedStorage) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, "oauth_client storage "+method,
+		attribute.String("storage.backend", is.backend))
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveStorage("oauth_client", is.backend, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (is *instrumentedStorage) Save(ctx context.Context, client auth.Client) error {
+	ctx, done := is.start(ctx, "Save")
+	err := is.storage.Save(ctx, client)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) GetById(ctx context.Context, id string) (auth.Client, error) {
+	ctx, done := is.start(ctx, "GetById")
+	client, err := is.storage.GetById(ctx, id)
+	done(err)
+	return client, err
+}
+
+func (is *instrumentedStorage) SaveCode(ctx context.Context, code string, ac auth.AuthorizationCode) error {
+	ctx, done := is.start(ctx, "SaveCode")
+	err := is.storage.SaveCode(ctx, code, ac)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) TakeCode(ctx context.Context, code string) (auth.AuthorizationCode, error) {
+	ctx, done := is.start(ctx, "TakeCode")
+	ac, err := is.storage.TakeCode(ctx, code)
+	done(err)
+	return ac, err
+}
+
+func (is *instrumentedStorage) Ping(ctx context.Context) error {
+	ctx, done := is.start(ctx, "Ping")
+	err := is.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Close() error {
+	return is.storage.Close()
+}
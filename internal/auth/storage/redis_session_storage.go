@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"time"
+)
+
+var _ auth.SessionStorage = &redisSessionStorage{}
+
+type redisSessionStorage struct {
+	client *redis.Client
+	logger *logrus.Logger
+}
+
+const (
+	sessionKeyPrefix      = ".session:"
+	loginSessionKeyPrefix = ".sessions:"
+)
+
+func NewRedisSessionStorage(host, port, password string, db int, timeout time.Duration, logger *logrus.Logger) (auth.SessionStorage, error) {
+	addr := net.JoinHostPort(host, port)
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+	_, err := client.Ping().Result()
+	if err != nil {
+		return nil, fmt.Errorf("no connection to Redis DB: %s", addr)
+	}
+	return &redisSessionStorage{
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+// with returns client which traces commands as part of ctx.
+func (rs *redisSessionStorage) with(ctx context.Context) *redis.Client {
+	return tracing.Redis(ctx, rs.client)
+}
+
+func (rs *redisSessionStorage) Save(ctx context.Context, session auth.Session) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("save session to redis")
+	if err := rs.set(ctx, session); err != nil {
+		return err
+	}
+	logger.Debug("add session to user's sessions")
+	key := loginSessionKeyPrefix + session.Login
+	_, err := rs.with(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(key, session.Id)
+		pipe.ExpireAt(key, session.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		logger.Debugf("error during adding session to user's sessions: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (rs *redisSessionStorage) GetById(ctx context.Context, id string) (auth.Session, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get session from redis")
+	logger.Tracef("get session by id: %s", id)
+	sessionStr, err := rs.with(ctx).Get(sessionKeyPrefix + id).Result()
+	if err != nil {
+		logger.Debugf("error during getting session: %v", err)
+		return auth.Session{}, fmt.Errorf("session with id '%s' not found: %w", id, err)
+	}
+	var session auth.Session
+	if err = json.Unmarshal([]byte(sessionStr), &session); err != nil {
+		logger.Debugf("error during unmarshaling session: %v", err)
+		return auth.Session{}, err
+	}
+	return session, nil
+}
+
+func (rs *redisSessionStorage) GetAllByLogin(ctx context.Context, login string) (auth.Sessions, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get user's sessions from redis")
+	key := loginSessionKeyPrefix + login
+	ids, err := rs.with(ctx).SMembers(key).Result()
+	if err != nil {
+		logger.Debugf("error during getting user's sessions: %v", err)
+		return nil, err
+	}
+	sessions := auth.Sessions{}
+	for _, id := range ids {
+		session, err := rs.GetById(ctx, id)
+		if err != nil {
+			logger.Debugf("drop expired session %s", id)
+			rs.with(ctx).SRem(key, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	logger.Debugf("found %d sessions", len(sessions))
+	return sessions, nil
+}
+
+func (rs *redisSessionStorage) Update(ctx context.Context, session auth.Session) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("update session in redis")
+	exists, err := rs.with(ctx).Exists(sessionKeyPrefix + session.Id).Result()
+	if err != nil {
+		logger.Debugf("error during checking session: %v", err)
+		return err
+	}
+	if exists == 0 {
+		logger.Debugf("session was not found, id: %s", session.Id)
+		return fmt.Errorf("session with id '%s' not found", session.Id)
+	}
+	return rs.set(ctx, session)
+}
+
+func (rs *redisSessionStorage) DeleteAllByLogin(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("delete user's sessions from redis")
+	key := loginSessionKeyPrefix + login
+	ids, err := rs.with(ctx).SMembers(key).Result()
+	if err != nil {
+		logger.Debugf("error during getting user's sessions: %v", err)
+		return err
+	}
+	keys := []string{key}
+	for _, id := range ids {
+		keys = append(keys, sessionKeyPrefix+id)
+	}
+	if err = rs.with(ctx).Del(keys...).Err(); err != nil {
+		logger.Debugf("error during deleting user's sessions: %v", err)
+		return err
+	}
+	logger.Debugf("deleted %d sessions", len(ids))
+	return nil
+}
+
+func (rs *redisSessionStorage) set(ctx context.Context, session auth.Session) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Debug("marshaling session")
+	bytes, err := json.Marshal(session)
+	if err != nil {
+		logger.Debugf("error during marshaling session: %v", err)
+		return err
+	}
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		logger.Debug("session is already expired")
+		return nil
+	}
+	logger.Debug("save session in redis")
+	if err = rs.with(ctx).Set(sessionKeyPrefix+session.Id, bytes, ttl).Err(); err != nil {
+		logger.Debugf("error during saving session: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (rs *redisSessionStorage) Ping(ctx context.Context) error {
+	return rs.with(ctx).Ping().Err()
+}
+
+func (rs *redisSessionStorage) Close() error {
+	rs.logger.Info("close session redis storage")
+	return rs.client.Close()
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"net"
+	"time"
+)
+
+var _ auth.ClientStorage = &redisStorage{}
+
+type redisStorage struct {
+	client *redis.Client
+	logger *logrus.Logger
+}
+
+const (
+	clientKeyPrefix = ".oauth_client:"
+	codeKeyPrefix   = ".oauth_code:"
+)
+
+func NewRedisStorage(host, port, password string, db int, timeout time.Duration, logger *logrus.Logger) (auth.ClientStorage, error) {
+	addr := net.JoinHostPort(host, port)
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+	_, err := client.Ping().Result()
+	if err != nil {
+		return nil, fmt.Errorf("no connection to Redis DB: %s", addr)
+	}
+	return &redisStorage{
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+// with returns client which traces commands as part of ctx.
+func (rs *redisStorage) with(ctx context.Context) *redis.Client {
+	return tracing.Redis(ctx, rs.client)
+}
+
+func (rs *redisStorage) Save(ctx context.Context, client auth.Client) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("save oauth client to redis")
+	logger.Debug("marshaling oauth client")
+	bytes, err := json.Marshal(client)
+	if err != nil {
+		logger.Debugf("error during marshaling oauth client: %v", err)
+		return err
+	}
+	logger.Debug("save oauth client in redis")
+	if err = rs.with(ctx).Set(clientKeyPrefix+client.Id, bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving oauth client: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (rs *redisStorage) GetById(ctx context.Context, id string) (auth.Client, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get oauth client from redis")
+	logger.Tracef("get oauth client by id: %s", id)
+	clientStr, err := rs.with(ctx).Get(clientKeyPrefix + id).Result()
+	if err != nil {
+		logger.Debugf("error during getting oauth client: %v", err)
+		return auth.Client{}, fmt.Errorf("oauth client with id '%s' not found: %w", id, err)
+	}
+	var client auth.Client
+	if err = json.Unmarshal([]byte(clientStr), &client); err != nil {
+		logger.Debugf("error during unmarshaling oauth client: %v", err)
+		return auth.Client{}, err
+	}
+	return client, nil
+}
+
+func (rs *redisStorage) SaveCode(ctx context.Context, code string, ac auth.AuthorizationCode) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("save authorization code to redis")
+	bytes, err := json.Marshal(ac)
+	if err != nil {
+		logger.Debugf("error during marshaling authorization code: %v", err)
+		return err
+	}
+	logger.Debug("save authorization code in redis until it expires")
+	if err = rs.with(ctx).Set(codeKeyPrefix+code, bytes, time.Until(ac.ExpiresAt)).Err(); err != nil {
+		logger.Debugf("error during saving authorization code: %v", err)
+		return problem.Storage.Wrap(err)
+	}
+	return nil
+}
+
+func (rs *redisStorage) TakeCode(ctx context.Context, code string) (auth.AuthorizationCode, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("take authorization code from redis")
+	logger.Debug("get and delete authorization code in transaction")
+	var get *redis.StringCmd
+	_, err := rs.with(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(codeKeyPrefix + code)
+		pipe.Del(codeKeyPrefix + code)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		logger.Debugf("error during taking authorization code: %v", err)
+		return auth.AuthorizationCode{}, problem.Storage.Wrap(err)
+	}
+	codeStr, err := get.Result()
+	if err == redis.Nil {
+		logger.Debug("authorization code was not found")
+		return auth.AuthorizationCode{}, problem.NotFound.WithDetail("authorization code not found")
+	} else if err != nil {
+		logger.Debugf("error during taking authorization code: %v", err)
+		return auth.AuthorizationCode{}, problem.Storage.Wrap(err)
+	}
+	var ac auth.AuthorizationCode
+	if err = json.Unmarshal([]byte(codeStr), &ac); err != nil {
+		logger.Debugf("error during unmarshaling authorization code: %v", err)
+		return auth.AuthorizationCode{}, err
+	}
+	return ac, nil
+}
+
+func (rs *redisStorage) Ping(ctx context.Context) error {
+	return rs.with(ctx).Ping().Err()
+}
+
+func (rs *redisStorage) Close() error {
+	rs.logger.Info("close oauth client redis storage")
+	return rs.client.Close()
+}
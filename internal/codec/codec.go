@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes responses and decodes request bodies of one wire format.
+type Codec interface {
+	// MediaTypes lists media types of the format, the first one is sent in
+	// Content-Type of responses.
+	MediaTypes() []string
+	Marshal(v interface{}) ([]byte, error)
+	Decode(r io.Reader, v interface{}) error
+}
+
+func contentType(c Codec) string {
+	return c.MediaTypes()[0]
+}
+
+// ProblemType is the media type of problem details encoded by c, e.g.
+// application/problem+cbor.
+func ProblemType(c Codec) string {
+	_, subtype, _ := strings.Cut(contentType(c), "/")
+	subtype = strings.TrimPrefix(strings.TrimPrefix(subtype, "x-"), "vnd.")
+	return "application/problem+" + subtype
+}
+
+// byContentType finds codec of request body. Empty content type is decoded
+// by the default codec.
+func (c *Codecs) byContentType(header string) Codec {
+	if header == "" {
+		return c.codecs[0]
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil
+	}
+	return c.byMediaType[mediaType]
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// byAccept picks codec of response according to Accept header. Missing
+// header accepts the default codec.
+func (c *Codecs) byAccept(header string) Codec {
+	if strings.TrimSpace(header) == "" {
+		return c.codecs[0]
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	for _, ar := range ranges {
+		if ar.mediaType == "*/*" {
+			return c.codecs[0]
+		}
+		if strings.HasSuffix(ar.mediaType, "/*") {
+			prefix := strings.TrimSuffix(ar.mediaType, "*")
+			for _, codec := range c.codecs {
+				for _, mediaType := range codec.MediaTypes() {
+					if strings.HasPrefix(mediaType, prefix) {
+						return codec
+					}
+				}
+			}
+			continue
+		}
+		if codec, ok := c.byMediaType[ar.mediaType]; ok {
+			return codec
+		}
+	}
+	return nil
+}
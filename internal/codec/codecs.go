@@ -0,0 +1,114 @@
+package codec
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// Codecs selects codecs of requests and responses by Content-Type and
+// Accept headers.
+type Codecs struct {
+	// codecs are ordered by preference, the first one is the default
+	codecs      []Codec
+	byMediaType map[string]Codec
+	supported   string
+	logger      *logrus.Logger
+}
+
+func New(logger *logrus.Logger, codecs ...Codec) *Codecs {
+	c := &Codecs{
+		codecs:      codecs,
+		byMediaType: make(map[string]Codec),
+		logger:      logger,
+	}
+	var supported []string
+	for _, codec := range codecs {
+		for _, mediaType := range codec.MediaTypes() {
+			c.byMediaType[mediaType] = codec
+		}
+		supported = append(supported, contentType(codec))
+	}
+	c.supported = strings.Join(supported, ", ")
+	return c
+}
+
+// Codecs returns all codecs in order of preference.
+func (c *Codecs) Codecs() []Codec {
+	return c.codecs
+}
+
+type negotiatedKey struct{}
+
+type negotiated struct {
+	request  Codec
+	response Codec
+}
+
+// Middleware negotiates codecs before handling request, so that requests of
+// unsupported types are rejected without side effects.
+func (c *Codecs) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context(), c.logger)
+		w.Header().Add("Vary", "Accept")
+		var n negotiated
+		accept := r.Header.Get("Accept")
+		if n.response = c.byAccept(accept); n.response == nil {
+			logger.Debugf("no acceptable content type in %q", accept)
+			problem.Write(w, r, problem.NotAcceptable.WithDetail(
+				fmt.Sprintf("responses are available as: %s", c.supported)), c.logger)
+			return
+		}
+		logger.Tracef("negotiated response content type %s", contentType(n.response))
+		// problems are sent in the negotiated format too, so that clients
+		// decode all responses the same way
+		response := n.response
+		r = r.WithContext(problem.WithEncoder(r.Context(), func(p *problem.Problem) (string, []byte, error) {
+			body, err := response.Marshal(p)
+			return ProblemType(response), body, err
+		}))
+		if r.ContentLength != 0 {
+			contentType := r.Header.Get("Content-Type")
+			if n.request = c.byContentType(contentType); n.request == nil {
+				logger.Debugf("unsupported content type %q", contentType)
+				problem.Write(w, r, problem.UnsupportedMediaType.WithDetail(
+					fmt.Sprintf("content type %s is not supported, use one of: %s", contentType, c.supported)), c.logger)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), negotiatedKey{}, n)))
+	})
+}
+
+func (c *Codecs) fromContext(ctx context.Context) negotiated {
+	n, _ := ctx.Value(negotiatedKey{}).(negotiated)
+	if n.request == nil {
+		n.request = c.codecs[0]
+	}
+	if n.response == nil {
+		n.response = c.codecs[0]
+	}
+	return n
+}
+
+// Decode reads request body into v with negotiated codec.
+func (c *Codecs) Decode(r *http.Request, v interface{}) error {
+	return c.fromContext(r.Context()).request.Decode(r.Body, v)
+}
+
+// Write sends v encoded with negotiated codec.
+func (c *Codecs) Write(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	codec := c.fromContext(r.Context()).response
+	bytes, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType(codec))
+	w.WriteHeader(status)
+	w.Write(bytes)
+	return nil
+}
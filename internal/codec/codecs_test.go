@@ -0,0 +1,223 @@
+package codec_test
+
+import (
+	"bytes"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec/format"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type echoDTO struct {
+	Text string `json:"text"`
+}
+
+func newTestCodecs(t *testing.T) *codec.Codecs {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cbor, err := format.NewCborCodec()
+	if err != nil {
+		t.Fatalf("create cbor codec: %v", err)
+	}
+	return codec.New(logger, format.NewJsonCodec(), format.NewMsgpackCodec(), cbor, format.NewYamlCodec())
+}
+
+// newEchoHandler decodes body and sends it back, requests with text "fail"
+// are answered with problem.
+func newEchoHandler(c *codec.Codecs) http.Handler {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return c.Middleware(problem.Middleware(func(w http.ResponseWriter, r *http.Request) error {
+		var dto echoDTO
+		if err := c.Decode(r, &dto); err != nil {
+			return problem.MalformedBody(err)
+		}
+		if dto.Text == "fail" {
+			return problem.Validation.WithDetail("text is invalid").
+				WithInvalidParams([]problem.InvalidParam{{Name: "body/text", Reason: "must not be fail"}})
+		}
+		return c.Write(w, r, http.StatusOK, dto)
+	}, logger))
+}
+
+func codecOf(t *testing.T, c *codec.Codecs, mediaType string) codec.Codec {
+	t.Helper()
+	for _, cc := range c.Codecs() {
+		for _, mt := range cc.MediaTypes() {
+			if mt == mediaType {
+				return cc
+			}
+		}
+	}
+	t.Fatalf("no codec of %s", mediaType)
+	return nil
+}
+
+func TestMiddleware_RoundTrip(t *testing.T) {
+	c := newTestCodecs(t)
+	h := newEchoHandler(c)
+	for _, mediaType := range []string{"application/json", "application/msgpack", "application/cbor", "application/yaml"} {
+		t.Run(mediaType, func(t *testing.T) {
+			cc := codecOf(t, c, mediaType)
+			body, err := cc.Marshal(echoDTO{Text: "hello"})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			r.Header.Set("Content-Type", mediaType)
+			r.Header.Set("Accept", mediaType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != mediaType {
+				t.Errorf("content type = %q, want %q", ct, mediaType)
+			}
+			var dto echoDTO
+			if err = cc.Decode(w.Body, &dto); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if dto.Text != "hello" {
+				t.Errorf("text = %q, want hello", dto.Text)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Accept(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{name: "no accept", accept: "", status: http.StatusOK, contentType: "application/json"},
+		{name: "any", accept: "*/*", status: http.StatusOK, contentType: "application/json"},
+		{name: "alias", accept: "application/x-msgpack", status: http.StatusOK, contentType: "application/msgpack"},
+		{name: "parameters", accept: "application/cbor; charset=utf-8", status: http.StatusOK, contentType: "application/cbor"},
+		{name: "highest quality", accept: "application/json;q=0.5, application/cbor;q=0.9, application/yaml;q=0.7",
+			status: http.StatusOK, contentType: "application/cbor"},
+		{name: "order of equal quality", accept: "application/yaml, application/json", status: http.StatusOK,
+			contentType: "application/yaml"},
+		{name: "unsupported preferred", accept: "text/html, application/msgpack;q=0.1", status: http.StatusOK,
+			contentType: "application/msgpack"},
+		{name: "type wildcard", accept: "text/*", status: http.StatusOK, contentType: "application/yaml"},
+		{name: "zero quality", accept: "application/json;q=0, application/yaml;q=0.1", status: http.StatusOK,
+			contentType: "application/yaml"},
+		{name: "nothing acceptable", accept: "text/html", status: http.StatusNotAcceptable,
+			contentType: problem.ContentType},
+		{name: "only zero quality", accept: "application/json;q=0", status: http.StatusNotAcceptable,
+			contentType: problem.ContentType},
+	}
+	c := newTestCodecs(t)
+	h := newEchoHandler(c)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"text":"hello"}`))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("content type = %q, want %q", ct, tt.contentType)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("vary = %q, want Accept", vary)
+			}
+		})
+	}
+}
+
+func TestMiddleware_UnsupportedMediaType(t *testing.T) {
+	c := newTestCodecs(t)
+	called := false
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`<text>hello</text>`))
+	r.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want 415", w.Code)
+	}
+	if called {
+		t.Error("handler is called for unsupported content type")
+	}
+
+	// requests without body need no content type
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !called {
+		t.Error("handler is not called for request without body")
+	}
+}
+
+func TestMiddleware_Problems(t *testing.T) {
+	c := newTestCodecs(t)
+	h := newEchoHandler(c)
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{accept: "application/json", contentType: "application/problem+json"},
+		{accept: "application/msgpack", contentType: "application/problem+msgpack"},
+		{accept: "application/cbor", contentType: "application/problem+cbor"},
+		{accept: "application/yaml", contentType: "application/problem+yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			cc := codecOf(t, c, tt.accept)
+			for _, request := range []struct {
+				name        string
+				contentType string
+				body        string
+				status      int
+				code        string
+			}{
+				{"handler problem", "application/json", `{"text":"fail"}`, http.StatusUnprocessableEntity, "validation_error"},
+				{"malformed body", "application/json", `{"text":`, http.StatusBadRequest, "bad_request"},
+				{"unsupported media type", "application/xml", `<text/>`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+			} {
+				r := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(request.body))
+				r.Header.Set("Content-Type", request.contentType)
+				r.Header.Set("Accept", tt.accept)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if w.Code != request.status {
+					t.Errorf("%s: status = %d, want %d", request.name, w.Code, request.status)
+				}
+				if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+					t.Errorf("%s: content type = %q, want %q", request.name, ct, tt.contentType)
+				}
+				var p problem.Problem
+				if err := cc.Decode(w.Body, &p); err != nil {
+					t.Fatalf("%s: decode problem: %v", request.name, err)
+				}
+				if p.Code != request.code || p.Status != request.status || p.Instance != "/echo" {
+					t.Errorf("%s: problem = %+v, want code %s", request.name, p, request.code)
+				}
+				if request.code == "validation_error" && (len(p.InvalidParams) != 1 || p.InvalidParams[0].Name != "body/text") {
+					t.Errorf("%s: invalid params = %+v", request.name, p.InvalidParams)
+				}
+			}
+		})
+	}
+}
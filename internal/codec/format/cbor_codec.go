@@ -0,0 +1,43 @@
+package format
+
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/fxamacker/cbor/v2"
+	"io"
+	"reflect"
+)
+
+var _ codec.Codec = &cborCodec{}
+
+// cborCodec falls back to json tags of dto and sends time as RFC 3339
+// string like json does.
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func NewCborCodec() (codec.Codec, error) {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		return nil, err
+	}
+	// maps decoded into interface{} must be encodable as json for api spec
+	// validation
+	dec, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		return nil, err
+	}
+	return &cborCodec{enc: enc, dec: dec}, nil
+}
+
+func (c *cborCodec) MediaTypes() []string {
+	return []string{"application/cbor"}
+}
+
+func (c *cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.enc.Marshal(v)
+}
+
+func (c *cborCodec) Decode(r io.Reader, v interface{}) error {
+	return c.dec.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,115 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testDTO struct {
+	Id        int        `json:"id"`
+	Title     string     `json:"title"`
+	Tags      []string   `json:"tags,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Hidden    string     `json:"-"`
+}
+
+func newTestCodecs(t *testing.T) []codec.Codec {
+	t.Helper()
+	cbor, err := NewCborCodec()
+	if err != nil {
+		t.Fatalf("create cbor codec: %v", err)
+	}
+	return []codec.Codec{NewJsonCodec(), NewMsgpackCodec(), cbor, NewYamlCodec()}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 15, 500, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	tests := []struct {
+		name string
+		dto  testDTO
+	}{
+		{
+			name: "all fields",
+			dto: testDTO{
+				Id:        1,
+				Title:     "title",
+				Tags:      []string{"a", "b"},
+				CreatedAt: createdAt,
+				UpdatedAt: &updatedAt,
+			},
+		},
+		{
+			name: "empty optional fields",
+			dto:  testDTO{Id: 2, Title: "", CreatedAt: createdAt},
+		},
+	}
+	for _, c := range newTestCodecs(t) {
+		for _, tt := range tests {
+			t.Run(c.MediaTypes()[0]+" "+tt.name, func(t *testing.T) {
+				dto := tt.dto
+				dto.Hidden = "secret"
+				b, err := c.Marshal(dto)
+				if err != nil {
+					t.Fatalf("marshal: %v", err)
+				}
+				if bytes.Contains(b, []byte("secret")) {
+					t.Error("field ignored by json is encoded")
+				}
+				var decoded testDTO
+				if err = c.Decode(bytes.NewReader(b), &decoded); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if !reflect.DeepEqual(decoded, tt.dto) {
+					t.Errorf("decoded = %+v, want %+v", decoded, tt.dto)
+				}
+			})
+		}
+	}
+}
+
+// TestCodecs_SameFields checks that all formats send the same fields and
+// values as json does, including time as RFC 3339 string.
+func TestCodecs_SameFields(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	dto := testDTO{Id: 1, Title: "title", CreatedAt: createdAt}
+	expected := map[string]interface{}{
+		"id":         float64(1),
+		"title":      "title",
+		"created_at": "2024-03-01T12:30:15Z",
+	}
+	for _, c := range newTestCodecs(t) {
+		t.Run(c.MediaTypes()[0], func(t *testing.T) {
+			b, err := c.Marshal(dto)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var raw interface{}
+			if err = c.Decode(bytes.NewReader(b), &raw); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if m, ok := raw.(map[string]interface{}); !ok {
+				t.Fatalf("decoded %T, want map", raw)
+			} else if _, ok = m["created_at"].(string); !ok {
+				t.Errorf("created_at is encoded as %T, want string", m["created_at"])
+			}
+			// numbers are compared as decoded from json
+			jsonBytes, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatalf("convert to json: %v", err)
+			}
+			var fields map[string]interface{}
+			if err = json.Unmarshal(jsonBytes, &fields); err != nil {
+				t.Fatalf("convert to json: %v", err)
+			}
+			if !reflect.DeepEqual(fields, expected) {
+				t.Errorf("fields = %v, want %v", fields, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package format
+
+import (
+	"encoding/json"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"io"
+)
+
+var _ codec.Codec = &jsonCodec{}
+
+type jsonCodec struct{}
+
+func NewJsonCodec() codec.Codec {
+	return &jsonCodec{}
+}
+
+func (c *jsonCodec) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (c *jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
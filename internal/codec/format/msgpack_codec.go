@@ -0,0 +1,60 @@
+package format
+
+import (
+	"bytes"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"reflect"
+	"time"
+)
+
+var _ codec.Codec = &msgpackCodec{}
+
+// msgpackCodec uses json tags of dto, so that field names are the same in
+// all formats, and sends time as RFC 3339 string like other codecs do.
+type msgpackCodec struct{}
+
+func init() {
+	// replaces timestamp extension of time fields
+	msgpack.Register(time.Time{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeString(v.Interface().(time.Time).Format(time.RFC3339Nano))
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		})
+}
+
+func NewMsgpackCodec() codec.Codec {
+	return &msgpackCodec{}
+}
+
+func (c *msgpackCodec) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (c *msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
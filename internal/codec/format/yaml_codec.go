@@ -0,0 +1,55 @@
+package format
+
+import (
+	"encoding/json"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"gopkg.in/yaml.v3"
+	"io"
+)
+
+var _ codec.Codec = &yamlCodec{}
+
+// yamlCodec converts values through json, so that json tags and marshalers
+// of dto apply to yaml too.
+type yamlCodec struct{}
+
+func NewYamlCodec() codec.Codec {
+	return &yamlCodec{}
+}
+
+func (c *yamlCodec) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml"}
+}
+
+func (c *yamlCodec) Marshal(v interface{}) ([]byte, error) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// node keeps order of fields, json is valid yaml in flow style
+	var node yaml.Node
+	if err := yaml.Unmarshal(jsonBytes, &node); err != nil {
+		return nil, err
+	}
+	resetStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+func (c *yamlCodec) Decode(r io.Reader, v interface{}) error {
+	var raw interface{}
+	if err := yaml.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+	jsonBytes, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
+}
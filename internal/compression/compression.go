@@ -0,0 +1,108 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	Gzip   = "gzip"
+	Brotli = "br"
+	Zstd   = "zstd"
+)
+
+// encoder is implemented by writers of all supported encodings, so that they
+// can be pooled and reused.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+func newPool(encoding string) (*sync.Pool, error) {
+	var newEncoder func() encoder
+	switch encoding {
+	case Gzip:
+		newEncoder = func() encoder {
+			return gzip.NewWriter(io.Discard)
+		}
+	case Brotli:
+		newEncoder = func() encoder {
+			return brotli.NewWriterLevel(io.Discard, brotliLevel)
+		}
+	case Zstd:
+		newEncoder = func() encoder {
+			// options are constant, so the error is never returned
+			enc, _ := zstd.NewWriter(io.Discard,
+				zstd.WithEncoderLevel(zstd.SpeedDefault),
+				zstd.WithEncoderConcurrency(1))
+			return enc
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+	return &sync.Pool{New: func() interface{} { return newEncoder() }}, nil
+}
+
+// brotliLevel trades ratio for speed, default level is too slow for
+// compressing responses on the fly.
+const brotliLevel = 4
+
+// negotiate picks encoding acceptable by client according to Accept-Encoding
+// header. Encodings with equal quality are preferred in order of supported.
+func negotiate(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				q = 0
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether responses of content type are worth
+// compressing, archives and media are compressed already.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, s := range []string{"json", "xml", "yaml", "javascript", "msgpack", "cbor"} {
+		if strings.Contains(mediaType, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package compression
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	supported := []string{Brotli, Zstd, Gzip}
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "no header", header: "", want: ""},
+		{name: "single encoding", header: "gzip", want: Gzip},
+		{name: "server preference on equal quality", header: "gzip, br", want: Brotli},
+		{name: "client quality", header: "gzip;q=1, br;q=0.5", want: Gzip},
+		{name: "refused encoding", header: "br;q=0, gzip", want: Gzip},
+		{name: "all refused", header: "br;q=0, zstd;q=0, gzip;q=0", want: ""},
+		{name: "identity only", header: "identity", want: ""},
+		{name: "identity refused", header: "identity;q=0", want: ""},
+		{name: "unsupported", header: "deflate", want: ""},
+		{name: "wildcard", header: "*", want: Brotli},
+		{name: "wildcard except refused", header: "*, br;q=0", want: Zstd},
+		{name: "wildcard refused", header: "*;q=0", want: ""},
+		{name: "named encoding overrides refused wildcard", header: "*;q=0, gzip", want: Gzip},
+		{name: "named encoding below wildcard", header: "*;q=0.8, br;q=0.5", want: Zstd},
+		{name: "case and spaces", header: " GZIP ; q=0.9 ", want: Gzip},
+		{name: "malformed quality", header: "gzip;q=high", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.header, supported); got != tt.want {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := map[string]bool{
+		"application/json":         true,
+		"application/problem+json": true,
+		"text/html; charset=utf-8": true,
+		"application/x-yaml":       true,
+		"application/vnd.msgpack":  true,
+		"application/zip":          false,
+		"image/png":                false,
+		"":                         false,
+	}
+	for contentType, want := range tests {
+		if got := compressible(contentType); got != want {
+			t.Errorf("compressible(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type Options struct {
+	// MinSize is the smallest response body in bytes which is compressed.
+	MinSize int
+	// Encodings are supported encodings in order of preference.
+	Encodings []string
+}
+
+// Middleware compresses responses with encoding negotiated by
+// Accept-Encoding and decompresses gzip request bodies.
+type Middleware struct {
+	minSize   int
+	encodings []string
+	pools     map[string]*sync.Pool
+	logger    *logrus.Logger
+}
+
+func NewMiddleware(options Options, logger *logrus.Logger) (*Middleware, error) {
+	m := &Middleware{
+		minSize:   options.MinSize,
+		encodings: options.Encodings,
+		pools:     make(map[string]*sync.Pool),
+		logger:    logger,
+	}
+	if len(m.encodings) == 0 {
+		m.encodings = []string{Brotli, Zstd, Gzip}
+	}
+	for _, encoding := range m.encodings {
+		pool, err := newPool(encoding)
+		if err != nil {
+			return nil, err
+		}
+		m.pools[encoding] = pool
+	}
+	return m, nil
+}
+
+// Compress wraps next with compression of responses and decompression of
+// requests. Nil middleware passes all requests.
+func (m *Middleware) Compress(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context(), m.logger)
+		if contentEncoding := r.Header.Get("Content-Encoding"); contentEncoding != "" {
+			if !strings.EqualFold(strings.TrimSpace(contentEncoding), Gzip) {
+				logger.Debugf("unsupported request content encoding %q", contentEncoding)
+				problem.Write(w, r, problem.UnsupportedMediaType.WithDetail(
+					fmt.Sprintf("content encoding %s is not supported, use gzip", contentEncoding)), m.logger)
+				return
+			}
+			body, err := gzip.NewReader(r.Body)
+			if err != nil {
+				logger.Debugf("error during reading gzip body: %v", err)
+				problem.Write(w, r, problem.BadRequest.Wrap(err).WithDetail("malformed gzip body"), m.logger)
+				return
+			}
+			defer body.Close()
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiate(r.Header.Get("Accept-Encoding"), m.encodings)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        m.minSize,
+			pool:           m.pools[encoding],
+			status:         http.StatusOK,
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
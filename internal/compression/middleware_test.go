@@ -0,0 +1,142 @@
+package compression_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/Frank-Way/note-go-rest-service/internal/compression"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestMiddleware(t *testing.T) *compression.Middleware {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	m, err := compression.NewMiddleware(compression.Options{MinSize: 64, Encodings: []string{compression.Gzip}}, logger)
+	if err != nil {
+		t.Fatalf("new middleware: %v", err)
+	}
+	return m
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMiddleware_CompressResponse(t *testing.T) {
+	large := strings.Repeat("note ", 100)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		method         string
+		contentType    string
+		body           string
+		encoding       string
+	}{
+		{name: "gzip accepted", acceptEncoding: "gzip", contentType: "application/json", body: large, encoding: "gzip"},
+		{name: "not accepted", acceptEncoding: "", contentType: "application/json", body: large},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0, identity", contentType: "application/json", body: large},
+		{name: "wildcard", acceptEncoding: "*", contentType: "application/json", body: large, encoding: "gzip"},
+		{name: "small body", acceptEncoding: "gzip", contentType: "application/json", body: "{}"},
+		{name: "compressed content type", acceptEncoding: "gzip", contentType: "application/zip", body: large},
+		{name: "head", acceptEncoding: "gzip", method: http.MethodHead, contentType: "application/json"},
+	}
+	m := newTestMiddleware(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := m.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/notes", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if encoding := w.Header().Get("Content-Encoding"); encoding != tt.encoding {
+				t.Fatalf("content encoding = %q, want %q", encoding, tt.encoding)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("vary = %q, want Accept-Encoding", vary)
+			}
+			body := w.Body.Bytes()
+			if tt.encoding == "gzip" {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip reader: %v", err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatalf("read gzip body: %v", err)
+				}
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestMiddleware_DecompressRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		status          int
+		want            string
+	}{
+		{name: "gzip body", contentEncoding: "gzip", body: gzipped(t, `{"title":"note"}`), status: http.StatusOK,
+			want: `{"title":"note"}`},
+		{name: "case insensitive", contentEncoding: "GZIP", body: gzipped(t, "note"), status: http.StatusOK, want: "note"},
+		{name: "plain body", body: []byte("note"), status: http.StatusOK, want: "note"},
+		{name: "malformed gzip", contentEncoding: "gzip", body: []byte("note"), status: http.StatusBadRequest},
+		{name: "unsupported encoding", contentEncoding: "br", body: []byte("note"), status: http.StatusUnsupportedMediaType},
+	}
+	m := newTestMiddleware(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := m.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+					t.Errorf("handler got content encoding %q", encoding)
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("read body: %v", err)
+				}
+				got = string(body)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/notes", bytes.NewReader(tt.body))
+			if tt.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package compression
+
+import (
+	"net/http"
+	"sync"
+)
+
+// compressWriter buffers beginning of response until it is known whether
+// the response is large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	pool        *sync.Pool
+	status      int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	encoder     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	if !cw.decided {
+		h := cw.Header()
+		if h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+			if err := cw.decide(false); err != nil {
+				return 0, err
+			}
+		} else {
+			cw.buf = append(cw.buf, b...)
+			if len(cw.buf) >= cw.minSize {
+				if err := cw.decide(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(b), nil
+		}
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide sends headers and buffered part of the response, compressed or as
+// is.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		cw.encoder = cw.pool.Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.minSize && compressible(cw.Header().Get("Content-Type")))
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends responses smaller than minimal size as is and completes
+// compressed ones.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+	err := cw.encoder.Close()
+	cw.encoder.Reset(nil)
+	cw.pool.Put(cw.encoder)
+	cw.encoder = nil
+	return err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
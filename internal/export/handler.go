@@ -0,0 +1,101 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/router"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+type Handler struct {
+	service Service
+	logger  *logrus.Logger
+}
+
+func NewHandler(service Service, logger *logrus.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Register adds export routes to rt.
+func (h *Handler) Register(rt *router.Router) {
+	const export = "/api/v1/users/{login:[A-Za-z0-9_]+}/export"
+	rt.Handle(http.MethodPost, export, h.handle(h.createJobHandler))
+	rt.Handle(http.MethodGet, export+"/{id:[0-9a-f]+}", h.handle(h.getJobHandler))
+	rt.Handle(http.MethodGet, export+"/{id:[0-9a-f]+}/download", h.handle(h.downloadHandler))
+}
+
+func (h *Handler) handle(handler func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return problem.Middleware(handler, h.logger)
+}
+
+func (h *Handler) createJobHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle create export job request")
+	login := router.Param(r, "login")
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Debug("pass login to service")
+	job, err := h.service.CreateJob(r.Context(), login)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	jsonBytes, err := json.Marshal(job)
+	if err != nil {
+		logger.Debugf("error during job marshaling: %v", err)
+		return err
+	}
+	w.Header().Set("Location", "/api/v1/users/"+login+"/export/"+job.Id)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jsonBytes)
+	return nil
+}
+
+func (h *Handler) getJobHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle get export job request")
+	login, id := router.Param(r, "login"), router.Param(r, "id")
+	logger.Tracef("got login '%s' and job id '%s' from path '%s'", login, id, r.URL.Path)
+	logger.Debug("pass login and id to service")
+	job, err := h.service.GetJob(r.Context(), login, id)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	jsonBytes, err := json.Marshal(job)
+	if err != nil {
+		logger.Debugf("error during job marshaling: %v", err)
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
+	return nil
+}
+
+func (h *Handler) downloadHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle download export archive request")
+	login, id := router.Param(r, "login"), router.Param(r, "id")
+	logger.Tracef("got login '%s' and job id '%s' from path '%s'", login, id, r.URL.Path)
+	query := r.URL.Query()
+	logger.Debug("pass link to service")
+	f, err := h.service.OpenArchive(r.Context(), login, id, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", login+"-export.zip"))
+	w.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(w, f); err != nil {
+		logger.Errorf("error during writing archive: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+type Job struct {
+	Id         string     `json:"id"`
+	Login      string     `json:"login"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	FilePath   string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+type Jobs = []Job
+
+func NewJob(id, login string) Job {
+	return Job{
+		Id:        id,
+		Login:     login,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Session is the part of session metadata included into the archive.
+type Session struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Revoked   bool      `json:"revoked"`
+}
+
+func NewSession(s auth.Session) Session {
+	return Session{
+		Id:        s.Id,
+		CreatedAt: s.CreatedAt,
+		LastSeen:  s.LastSeenAt,
+		IP:        s.Ip,
+		UserAgent: s.UserAgent,
+		Revoked:   s.RevokedAt != nil,
+	}
+}
+
+type Profile struct {
+	user.ProfileDTO
+	Id            int        `json:"id"`
+	IsActive      bool       `json:"is_active"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+}
@@ -0,0 +1,384 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/note"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var _ Service = &service{}
+var _ user.Exports = &service{}
+
+// queueRetryAfter is suggested to clients when export queue is full.
+const queueRetryAfter = 30 * time.Second
+
+type Service interface {
+	CreateJob(ctx context.Context, login string) (JobDTO, error)
+	GetJob(ctx context.Context, login string, id string) (JobDTO, error)
+	OpenArchive(ctx context.Context, login string, id string, expires string, signature string) (*os.File, error)
+	DeleteAll(ctx context.Context, login string) error
+	Run(ctx context.Context)
+}
+
+// Options configures export jobs. Archives are written to Dir and may be
+// downloaded by the signed link until LinkTTL is over.
+type Options struct {
+	Dir     string
+	LinkTTL time.Duration
+}
+
+type service struct {
+	storage  Storage
+	users    user.Storage
+	notes    note.Storage
+	sessions SessionLister
+	options  Options
+	key      []byte
+	queue    chan string
+	logger   *logrus.Logger
+}
+
+func NewService(storage Storage, users user.Storage, notes note.Storage,
+	sessions SessionLister, options Options, logger *logrus.Logger) (Service, error) {
+	if err := os.MkdirAll(options.Dir, 0700); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &service{
+		storage:  storage,
+		users:    users,
+		notes:    notes,
+		sessions: sessions,
+		options:  options,
+		key:      key,
+		queue:    make(chan string, 100),
+		logger:   logger,
+	}, nil
+}
+
+func (s service) CreateJob(ctx context.Context, login string) (JobDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("create export job")
+	if err := s.checkAuth(ctx, login); err != nil {
+		return JobDTO{}, err
+	}
+	logger.Debug("generate job id")
+	id, err := newId()
+	if err != nil {
+		logger.Debugf("error during generating job id: %v", err)
+		return JobDTO{}, err
+	}
+	job := NewJob(id, login)
+	logger.Debug("pass job to storage to save it")
+	if err = s.storage.Save(ctx, job); err != nil {
+		logger.Debugf("error during saving job: %v", err)
+		return JobDTO{}, err
+	}
+	logger.Debug("enqueue job")
+	select {
+	case s.queue <- job.Id:
+	default:
+		logger.Debug("export queue is full")
+		_ = s.storage.Delete(ctx, job.Id)
+		return JobDTO{}, problem.Unavailable.WithDetail("too many export jobs, try again later").
+			WithRetryAfter(queueRetryAfter)
+	}
+	logger.Debug("export job created")
+	return s.toDTO(job), nil
+}
+
+func (s service) GetJob(ctx context.Context, login string, id string) (JobDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("get export job")
+	if err := s.checkAuth(ctx, login); err != nil {
+		return JobDTO{}, err
+	}
+	job, err := s.getUsersJob(ctx, login, id)
+	if err != nil {
+		return JobDTO{}, err
+	}
+	return s.toDTO(job), nil
+}
+
+func (s service) OpenArchive(ctx context.Context, login string, id string, expires string,
+	signature string) (*os.File, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("open export archive")
+	logger.Debug("check link signature")
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(s.sign(login, id, expiresAt))) {
+		logger.Debug("wrong link signature")
+		return nil, problem.Unauthorized.WithDetail("invalid download link")
+	}
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		logger.Debug("link expired")
+		return nil, problem.Unauthorized.WithDetail("download link expired")
+	}
+	job, err := s.getUsersJob(ctx, login, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusDone {
+		logger.Debugf("job is in status %q", job.Status)
+		return nil, problem.NotFound.WithDetail("export archive is not ready")
+	}
+	logger.Debugf("open archive %s", job.FilePath)
+	return os.Open(job.FilePath)
+}
+
+// DeleteAll deletes export jobs of user with their archives.
+func (s service) DeleteAll(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("delete export jobs of user")
+	logger.Debug("get all jobs from storage")
+	jobs, err := s.storage.GetAll(ctx)
+	if err != nil {
+		logger.Debugf("error during getting export jobs: %v", err)
+		return err
+	}
+	for _, job := range jobs {
+		if job.Login != login {
+			continue
+		}
+		if err = s.delete(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s service) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("start export worker")
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stop export worker")
+			return
+		case id := <-s.queue:
+			s.process(ctx, id)
+		case <-ticker.C:
+			s.cleanup(ctx)
+		}
+	}
+}
+
+func (s service) process(ctx context.Context, id string) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infof("process export job %s", id)
+	job, err := s.storage.GetById(ctx, id)
+	if err != nil {
+		logger.Errorf("error during getting export job %s: %v", id, err)
+		return
+	}
+	job.Status = StatusRunning
+	if err = s.storage.Update(ctx, job); err != nil {
+		logger.Errorf("error during updating export job %s: %v", id, err)
+		return
+	}
+	path := filepath.Join(s.options.Dir, job.Id+".zip")
+	if err = s.writeArchive(ctx, job.Login, path); err != nil {
+		logger.Errorf("error during building export archive %s: %v", id, err)
+		_ = os.Remove(path)
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusDone
+		job.FilePath = path
+	}
+	now := time.Now()
+	expiresAt := now.Add(s.options.LinkTTL)
+	job.FinishedAt = &now
+	job.ExpiresAt = &expiresAt
+	if err = s.storage.Update(ctx, job); err != nil {
+		// job may be deleted with its user meanwhile
+		logger.Errorf("error during updating export job %s: %v", id, err)
+		_ = os.Remove(path)
+	}
+	logger.Debugf("export job %s finished with status %q", id, job.Status)
+}
+
+func (s service) writeArchive(ctx context.Context, login string, path string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debugf("collect data of user %q", login)
+	u, err := s.users.GetByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+	profile := Profile{
+		ProfileDTO:    user.NewProfile(u),
+		Id:            u.Id,
+		IsActive:      u.IsActive,
+		DeactivatedAt: u.DeactivatedAt,
+	}
+	notes, err := s.notes.GetAll(ctx, login)
+	if errors.Is(err, problem.NotFound) {
+		logger.Debug("user has no notes")
+		notes, err = note.Notes{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if notes == nil {
+		notes = note.Notes{}
+	}
+	sessions := []Session{}
+	if s.sessions != nil {
+		userSessions, err := s.sessions.ListSessions(ctx, login)
+		if err != nil {
+			return err
+		}
+		for _, session := range userSessions {
+			sessions = append(sessions, NewSession(session))
+		}
+	}
+	logger.Debugf("write archive %s", path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, v := range map[string]interface{}{
+		"profile.json":  profile,
+		"notes.json":    notes,
+		"sessions.json": sessions,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (s service) cleanup(ctx context.Context) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("cleanup expired export jobs")
+	jobs, err := s.storage.GetAll(ctx)
+	if err != nil {
+		logger.Errorf("error during getting export jobs: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if job.ExpiresAt == nil || now.Before(*job.ExpiresAt) {
+			continue
+		}
+		logger.Debugf("export job %s expired", job.Id)
+		if err := s.delete(ctx, job); err != nil {
+			logger.Errorf("error during deleting export job %s: %v", job.Id, err)
+		}
+	}
+}
+
+// delete removes archive of job and then the job, so that job is kept to
+// retry when archive can not be removed.
+func (s service) delete(ctx context.Context, job Job) error {
+	logger := logging.FromContext(ctx, s.logger)
+	if job.FilePath != "" {
+		logger.Debugf("remove archive %s", job.FilePath)
+		if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			logger.Debugf("error during removing archive: %v", err)
+			return err
+		}
+	}
+	logger.Debugf("delete export job %s", job.Id)
+	if err := s.storage.Delete(ctx, job.Id); err != nil && !errors.Is(err, problem.NotFound) {
+		logger.Debugf("error during deleting export job: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s service) checkAuth(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("authorize request")
+	principal, err := auth.Authorize(ctx)
+	if err != nil {
+		logger.Debug("error during authorization")
+		return err
+	}
+	authLogin := principal.Login
+	logger.Debug("check if request is authorized")
+	if authLogin != login {
+		logger.Debug("logins mismatch")
+		return problem.Forbidden.WithDetail("attempt to export another user's data")
+	}
+	return nil
+}
+
+func (s service) getUsersJob(ctx context.Context, login string, id string) (Job, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("get job from storage")
+	job, err := s.storage.GetById(ctx, id)
+	if err != nil {
+		logger.Debugf("error during getting job: %v", err)
+		return Job{}, err
+	}
+	if job.Login != login {
+		logger.Debug("job belongs to another user")
+		return Job{}, problem.NotFound.WithDetail(fmt.Sprintf("export job with id '%s' not found", id))
+	}
+	return job, nil
+}
+
+func (s service) toDTO(job Job) JobDTO {
+	dto := JobDTO{
+		Id:         job.Id,
+		Status:     job.Status,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+		ExpiresAt:  job.ExpiresAt,
+	}
+	if job.Status == StatusDone && job.ExpiresAt != nil {
+		expires := job.ExpiresAt.Unix()
+		dto.DownloadUrl = fmt.Sprintf("/api/v1/users/%s/export/%s/download?expires=%d&signature=%s",
+			job.Login, job.Id, expires, s.sign(job.Login, job.Id, expires))
+	}
+	return dto
+}
+
+func (s service) sign(login string, id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s|%s|%d", login, id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
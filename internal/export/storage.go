@@ -0,0 +1,20 @@
+package export
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+)
+
+type Storage interface {
+	Save(ctx context.Context, job Job) error
+	GetById(ctx context.Context, id string) (Job, error)
+	GetAll(ctx context.Context) (Jobs, error)
+	Update(ctx context.Context, job Job) error
+	Delete(ctx context.Context, id string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type SessionLister interface {
+	ListSessions(ctx context.Context, login string) (auth.Sessions, error)
+}
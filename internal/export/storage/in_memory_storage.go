@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/export"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+var _ export.Storage = &inMemoryStorage{}
+
+type inMemoryStorage struct {
+	sync.Mutex
+	logger *logrus.Logger
+
+	jobs map[string]export.Job
+}
+
+func NewInMemoryStorage(logger *logrus.Logger) export.Storage {
+	ims := &inMemoryStorage{}
+	ims.logger = logger
+	ims.jobs = make(map[string]export.Job)
+	return ims
+}
+
+func (ims *inMemoryStorage) Save(ctx context.Context, job export.Job) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("save export job to in_memory_storage")
+	ims.jobs[job.Id] = job
+	logger.Debug("export job was saved")
+	return nil
+}
+
+func (ims *inMemoryStorage) GetById(ctx context.Context, id string) (export.Job, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get export job from in_memory_storage")
+	logger.Debugf("find export job by id: %s", id)
+	job, ok := ims.jobs[id]
+	if ok {
+		logger.Debug("export job found")
+		return job, nil
+	} else {
+		logger.Debugf("export job was not found, id: %s", id)
+		return export.Job{}, problem.NotFound.WithDetail(fmt.Sprintf("export job with id '%s' not found", id))
+	}
+}
+
+func (ims *inMemoryStorage) GetAll(ctx context.Context) (export.Jobs, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get export jobs from in_memory_storage")
+	var res export.Jobs
+	for _, v := range ims.jobs {
+		res = append(res, v)
+	}
+	logger.Debug("export jobs found")
+	return res, nil
+}
+
+func (ims *inMemoryStorage) Update(ctx context.Context, job export.Job) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("update export job in in_memory_storage")
+	logger.Debugf("find export job by id: %s", job.Id)
+	if _, ok := ims.jobs[job.Id]; !ok {
+		logger.Debugf("export job was not found, id: %s", job.Id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("export job with id '%s' not found", job.Id))
+	}
+	ims.jobs[job.Id] = job
+	logger.Debug("export job updated")
+	return nil
+}
+
+func (ims *inMemoryStorage) Delete(ctx context.Context, id string) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("delete export job from in_memory_storage")
+	logger.Debugf("find export job by id: %s", id)
+	if _, ok := ims.jobs[id]; !ok {
+		logger.Debugf("export job was not found, id: %s", id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("export job with id '%s' not found", id))
+	}
+	delete(ims.jobs, id)
+	logger.Debug("export job deleted")
+	return nil
+}
+
+func (ims *inMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ims *inMemoryStorage) Close() error {
+	ims.logger.Info("close export job in_memory_storage")
+	return nil
+}
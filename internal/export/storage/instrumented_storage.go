@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/export"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+var _ export.Storage = &instrumentedStorage{}
+
+// instrumentedStorage records latency and spans of operations of wrapped storage.
+type instrumentedStorage struct {
+	storage export.Storage
+	backend string
+}
+
+func NewInstrumentedStorage(storage export.Storage, backend string) export.Storage {
+	return &instrumentedStorage{
+		storage: storage,
+		backend: backend,
+	}
+}
+
+func (is *instrumentedStorage) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, "export storage "+method,
+		attribute.String("storage.backend", is.backend))
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveStorage("export", is.backend, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (is *instrumentedStorage) Save(ctx context.Context, job export.Job) error {
+	ctx, done := is.start(ctx, "Save")
+	err := is.storage.Save(ctx, job)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) GetById(ctx context.Context, id string) (export.Job, error) {
+	ctx, done := is.start(ctx, "GetById")
+	job, err := is.storage.GetById(ctx, id)
+	done(err)
+	return job, err
+}
+
+func (is *instrumentedStorage) GetAll(ctx context.Context) (export.Jobs, error) {
+	ctx, done := is.start(ctx, "GetAll")
+	jobs, err := is.storage.GetAll(ctx)
+	done(err)
+	return jobs, err
+}
+
+func (is *instrumentedStorage) Update(ctx context.Context, job export.Job) error {
+	ctx, done := is.start(ctx, "Update")
+	err := is.storage.Update(ctx, job)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Delete(ctx context.Context, id string) error {
+	ctx, done := is.start(ctx, "Delete")
+	err := is.storage.Delete(ctx, id)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Ping(ctx context.Context) error {
+	ctx, done := is.start(ctx, "Ping")
+	err := is.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Close() error {
+	return is.storage.Close()
+}
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errDiskSpaceUnsupported = errors.New("disk space check is not supported on this platform")
+
+// DiskSpaceCheck fails when free space of the file system dir belongs to is
+// less than minFree bytes.
+func DiskSpaceCheck(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := freeDiskSpace(dir)
+		if errors.Is(err, errDiskSpaceUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free in %s, at least %d required", free, dir, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"encoding/json"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type Handler struct {
+	checker *Checker
+	ready   func() bool
+	logger  *logrus.Logger
+}
+
+func NewHandler(checker *Checker, ready func() bool, logger *logrus.Logger) *Handler {
+	return &Handler{
+		checker: checker,
+		ready:   ready,
+		logger:  logger,
+	}
+}
+
+// Livez reports that the process is able to serve requests, dependencies
+// are not checked.
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	h.writeReport(w, Report{
+		Status:    StatusOk,
+		CheckedAt: time.Now(),
+		Checks:    map[string]CheckResult{},
+	})
+}
+
+// Readyz reports whether the service and its dependencies are ready to
+// serve requests.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context(), h.logger)
+	if !h.ready() {
+		h.writeReport(w, Report{
+			Status:    StatusFail,
+			CheckedAt: time.Now(),
+			Checks: map[string]CheckResult{
+				"server": {Status: StatusFail, Error: "server is shutting down"},
+			},
+		})
+		return
+	}
+	report := h.checker.Check(r.Context())
+	if !report.IsOk() {
+		logger.Warnf("readiness check failed: %+v", report.Checks)
+	}
+	h.writeReport(w, report)
+}
+
+func (h *Handler) writeReport(w http.ResponseWriter, report Report) {
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		h.logger.Errorf("error during marshaling health report: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.IsOk() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+// Check reports whether a dependency of the service is usable.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+func (r *Report) IsOk() bool {
+	return r.Status == StatusOk
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs checks concurrently and caches the report for cacheTTL, so
+// that frequent probes do not load dependencies.
+type Checker struct {
+	sync.Mutex
+	checks   []namedCheck
+	cacheTTL time.Duration
+	timeout  time.Duration
+
+	report *Report
+}
+
+func NewChecker(cacheTTL time.Duration, timeout time.Duration) *Checker {
+	return &Checker{
+		cacheTTL: cacheTTL,
+		timeout:  timeout,
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+	c.report = nil
+}
+
+func (c *Checker) Names() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	names := make([]string, 0, len(c.checks))
+	for _, nc := range c.checks {
+		names = append(names, nc.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Checker) Check(ctx context.Context) Report {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.cacheTTL {
+		return *c.report
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status:    StatusOk,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]CheckResult, len(c.checks)),
+	}
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, nc.check)
+	}
+	wg.Wait()
+	for i, nc := range c.checks {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOk {
+			report.Status = StatusFail
+		}
+	}
+	c.report = &report
+	return report
+}
+
+func run(ctx context.Context, check Check) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{
+		Status:    StatusOk,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Frank-Way/note-go-rest-service/internal/response"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDRe limits accepted request ids, so that clients can not inject
+// arbitrary content into logs.
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestInfo collects details known only to code handling the request.
+type requestInfo struct {
+	requestID string
+	login     string
+}
+
+type requestInfoKey struct{}
+
+// SetLogin remembers login of authorized client to report it in access log.
+func SetLogin(ctx context.Context, login string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.login = login
+	}
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.requestID
+	}
+	return ""
+}
+
+// Middleware assigns id to the request, puts logger with that id into
+// request context and logs the request when it is handled. Id passed by
+// client in X-Request-ID header is reused.
+func Middleware(logger *logrus.Logger, route func(path string) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{requestID: r.Header.Get(RequestIDHeader)}
+		if !requestIDRe.MatchString(info.requestID) {
+			info.requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.requestID)
+		fields := logrus.Fields{"request_id": info.requestID}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+		}
+		entry := logger.WithFields(fields)
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		ctx = WithEntry(ctx, entry)
+		rec := response.NewRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		entry.WithFields(logrus.Fields{
+			"method":      r.Method,
+			"route":       route(r.URL.Path),
+			"path":        r.URL.Path,
+			"status":      rec.Status(),
+			"bytes":       rec.Bytes(),
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"login":       info.login,
+			"remote_addr": r.RemoteAddr,
+		}).Info("request handled")
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
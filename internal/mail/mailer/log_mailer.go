@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail"
+	"github.com/sirupsen/logrus"
+)
+
+var _ mail.Mailer = &logMailer{}
+
+type logMailer struct {
+	logger *logrus.Logger
+}
+
+func NewLogMailer(logger *logrus.Logger) mail.Mailer {
+	return &logMailer{
+		logger: logger,
+	}
+}
+
+func (lm *logMailer) Send(ctx context.Context, to, subject, body string) error {
+	logger := logging.FromContext(ctx, lm.logger)
+	logger.Info("send mail to log")
+	logger.Infof("to: %s, subject: %q, body: %q", to, subject, body)
+	return nil
+}
@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+var _ mail.Mailer = &smtpMailer{}
+
+type smtpMailer struct {
+	addr   string
+	auth   smtp.Auth
+	from   string
+	logger *logrus.Logger
+}
+
+func NewSmtpMailer(host, port, username, password, from string, logger *logrus.Logger) mail.Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{
+		addr:   net.JoinHostPort(host, port),
+		auth:   auth,
+		from:   from,
+		logger: logger,
+	}
+}
+
+func (sm *smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	logger := logging.FromContext(ctx, sm.logger)
+	logger.Info("send mail via smtp")
+	logger.Debugf("build message for %s", to)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", sm.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	logger.Debugf("send message to smtp server %s", sm.addr)
+	if err := smtp.SendMail(sm.addr, sm.auth, sm.from, []string{to}, []byte(msg.String())); err != nil {
+		logger.Debugf("error during sending mail: %v", err)
+		return err
+	}
+	return nil
+}
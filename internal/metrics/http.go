@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/response"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unmatchedRoute labels requests to paths not matching any route, so that
+// arbitrary paths do not produce unbounded number of series.
+const unmatchedRoute = "other"
+
+type route struct {
+	template string
+	re       *regexp.Regexp
+}
+
+// RouteMatcher maps request paths to route templates like
+// /api/v1/users/{login}, so that requests are labelled without path
+// parameters.
+type RouteMatcher struct {
+	routes []route
+}
+
+func NewRouteMatcher(templates ...string) *RouteMatcher {
+	rm := &RouteMatcher{}
+	for _, t := range templates {
+		segments := strings.Split(t, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				segments[i] = `[^/]+`
+			} else {
+				segments[i] = regexp.QuoteMeta(segment)
+			}
+		}
+		rm.routes = append(rm.routes, route{
+			template: t,
+			re:       regexp.MustCompile("^" + strings.Join(segments, "/") + "$"),
+		})
+	}
+	return rm
+}
+
+func (rm *RouteMatcher) Route(path string) string {
+	for _, r := range rm.routes {
+		if r.re.MatchString(path) {
+			return r.template
+		}
+	}
+	return unmatchedRoute
+}
+
+// Middleware counts requests and records their latency labelled by method,
+// route template and response status.
+func Middleware(routes *RouteMatcher, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := response.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+		labels := []string{r.Method, routes.Route(r.URL.Path), strconv.Itoa(rec.Status())}
+		httpRequests.WithLabelValues(labels...).Inc()
+		httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
@@ -9,3 +9,7 @@ type UpdateNoteDTO struct {
 	Title string `db:"title" json:"title"`
 	Text  string `db:"text" json:"text"`
 }
+
+type LocationDTO struct {
+	Location string `json:"location"`
+}
@@ -1,192 +1,168 @@
 package note
 
 import (
-	"encoding/json"
-	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/router"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"regexp"
 	"strconv"
 )
 
 type Handler struct {
 	service Service
+	codecs  *codec.Codecs
 	logger  *logrus.Logger
 }
 
-func NewHandler(service Service, logger *logrus.Logger) *Handler {
+func NewHandler(service Service, codecs *codec.Codecs, logger *logrus.Logger) *Handler {
 	return &Handler{
 		service: service,
+		codecs:  codecs,
 		logger:  logger,
 	}
 }
 
-var (
-	noIdRe = regexp.MustCompile(`^/api/v1/notes$`)
-	idRe   = regexp.MustCompile(`^/api/v1/notes/(\d+)$`)
-)
+// Register adds note routes to rt.
+func (h *Handler) Register(rt *router.Router) {
+	rt.Handle(http.MethodPost, "/api/v1/notes", h.handle(h.saveHandler))
+	rt.Handle(http.MethodGet, "/api/v1/notes", h.handle(h.getAllHandler))
+	rt.Handle(http.MethodGet, "/api/v1/notes/{id:[0-9]+}", h.handle(h.getHandler))
+	rt.Handle(http.MethodPut, "/api/v1/notes/{id:[0-9]+}", h.handle(h.updateHandler))
+	rt.Handle(http.MethodDelete, "/api/v1/notes/{id:[0-9]+}", h.handle(h.deleteHandler))
+}
 
-func (h *Handler) Handler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle note request")
-	w.Header().Set("content-type", "application/json")
-	switch {
-	case r.Method == http.MethodPost && noIdRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to save handler")
-		return h.saveHandler(w, r)
-	case r.Method == http.MethodGet && idRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to get handler")
-		return h.getHandler(w, r)
-	case r.Method == http.MethodGet && noIdRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to get all handler")
-		return h.getAllHandler(w, r)
-	case r.Method == http.MethodPut && idRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to update handler")
-		return h.updateHandler(w, r)
-	case r.Method == http.MethodDelete && idRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to delete handler")
-		return h.deleteHandler(w, r)
-	default:
-		h.logger.Debug("no handlers for request")
-		return fmt.Errorf("wrong method %s on path: %s", r.Method, r.URL.Path)
-	}
+func (h *Handler) handle(handler func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return h.codecs.Middleware(problem.Middleware(handler, h.logger))
 }
 
 func (h *Handler) saveHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle save note request")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle save note request")
 	var dto CreateNoteDTO
-	h.logger.Debug("decoding note dto from json")
-	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
-		h.logger.Debugf("error during decoding json: %v", err)
+	logger.Debug("decoding note dto")
+	if err := h.codecs.Decode(r, &dto); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
+	}
+	logger.Tracef("note dto decoded: %v", dto)
+	logger.Debug("pass auth and note dto to service to save it")
+	uri, err := h.service.CreateNote(r.Context(), dto)
+	if err != nil {
+		logger.Debugf("error during saving note in service: %v", err)
 		return err
 	}
-	h.logger.Tracef("note dto decoded from json: %v", dto)
-	h.logger.Debug("get header 'Authorization' from request")
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass auth and note dto to service to save it")
-	uri, err := h.service.CreateNote(r.Context(), authHeader, dto)
-	if err != nil {
-		h.logger.Debugf("error during saving note in service: %v", err)
+	location := "/api/v1/notes/" + uri
+	w.Header().Set("Location", location)
+	if err := h.codecs.Write(w, r, http.StatusCreated, LocationDTO{Location: location}); err != nil {
+		logger.Debugf("error during location marshaling: %v", err)
 		return err
 	}
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Location", "/api/v1/notes/"+uri)
-	w.Write([]byte("/api/v1/notes/" + uri))
-	h.logger.Debug("note saved")
+	logger.Debug("note saved")
 	return nil
 }
 
 func (h *Handler) getHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle get note request")
-	h.logger.Debug("getting id from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle get note request")
+	logger.Debug("getting id from request path")
 	id, err := getIdFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting id: %v", err)
+		logger.Debugf("error during getting id: %v", err)
 		return err
 	}
-	h.logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
-	h.logger.Debug("get header 'Authorization' from request")
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass auth and id to service to get note")
-	n, err := h.service.GetNote(r.Context(), authHeader, id)
+	logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
+	logger.Debug("pass auth and id to service to get note")
+	n, err := h.service.GetNote(r.Context(), id)
 	if err != nil {
-		h.logger.Debugf("error during getting note from service: %v", err)
+		logger.Debugf("error during getting note from service: %v", err)
 		return err
 	}
-	h.logger.Tracef("got note from service: %v", n)
-	h.logger.Debug("marshaling note")
-	jsonBytes, err := json.Marshal(n)
-	if err != nil {
-		h.logger.Debugf("error during note marshaling: %s", err)
+	logger.Tracef("got note from service: %v", n)
+	logger.Debug("writing note")
+	if err := h.codecs.Write(w, r, http.StatusOK, n); err != nil {
+		logger.Debugf("error during note marshaling: %s", err)
 		return err
 	}
-	h.logger.Trace("note marshal succeed")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
-	h.logger.Debug("return note")
+	logger.Debug("return note")
 	return nil
 }
 
 func (h *Handler) getAllHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle get all notes request")
-	h.logger.Debug("get header 'Authorization' from request")
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass auth to service to get all notes")
-	n, err := h.service.GetAllNotes(r.Context(), authHeader)
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle get all notes request")
+	logger.Debug("pass auth to service to get all notes")
+	n, err := h.service.GetAllNotes(r.Context())
 	if err != nil {
-		h.logger.Debugf("error during getting notes from service: %v", err)
+		logger.Debugf("error during getting notes from service: %v", err)
 		return err
 	}
-	h.logger.Tracef("got notes from storage: %v", n)
-	h.logger.Debug("marshaling notes")
-	jsonBytes, err := json.Marshal(n)
-	if err != nil {
-		h.logger.Debugf("error during note marshaling: %v", err)
+	logger.Tracef("got notes from storage: %v", n)
+	logger.Debug("writing notes")
+	if err := h.codecs.Write(w, r, http.StatusOK, n); err != nil {
+		logger.Debugf("error during notes marshaling: %v", err)
 		return err
 	}
-	h.logger.Trace("notes marshal succeed")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
-	h.logger.Debug("return notes")
+	logger.Debug("return notes")
 	return nil
 }
 
 func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle update note request")
-	h.logger.Debug("getting id from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle update note request")
+	logger.Debug("getting id from request path")
 	id, err := getIdFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting id: %v", err)
+		logger.Debugf("error during getting id: %v", err)
 		return err
 	}
-	h.logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
+	logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
 	var dto UpdateNoteDTO
-	h.logger.Debug("decoding note dto from json")
-	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
-		h.logger.Debugf("error during decoding json: %v", err)
-		return err
-	}
-	h.logger.Tracef("note dto decoded from json: %v", dto)
-	h.logger.Debug("get header 'Authorization' from request")
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass auth and note dto to service to update it")
-	if err := h.service.UpdateNote(r.Context(), authHeader, id, dto); err != nil {
-		h.logger.Debugf("error during updating note in service: %v", err)
+	logger.Debug("decoding note dto")
+	if err := h.codecs.Decode(r, &dto); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
+	}
+	logger.Tracef("note dto decoded: %v", dto)
+	logger.Debug("pass auth and note dto to service to update it")
+	if err := h.service.UpdateNote(r.Context(), id, dto); err != nil {
+		logger.Debugf("error during updating note in service: %v", err)
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
-	h.logger.Debug("note updated")
+	logger.Debug("note updated")
 	return nil
 }
 
 func (h *Handler) deleteHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle delete note request")
-	h.logger.Debug("getting id from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle delete note request")
+	logger.Debug("getting id from request path")
 	id, err := getIdFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting id: %v", err)
+		logger.Debugf("error during getting id: %v", err)
 		return err
 	}
-	h.logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
-	h.logger.Debug("get header 'Authorization' from request")
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass auth and id to service to delete note")
-	if err := h.service.DeleteNote(r.Context(), authHeader, id); err != nil {
-		h.logger.Debugf("error during deleting note from service: %v", err)
+	logger.Tracef("got id '%d' from path '%s'", id, r.URL.Path)
+	logger.Debug("pass auth and id to service to delete note")
+	if err := h.service.DeleteNote(r.Context(), id); err != nil {
+		logger.Debugf("error during deleting note from service: %v", err)
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
-	h.logger.Debug("note deleted")
+	logger.Debug("note deleted")
 	return nil
 }
 
 func getIdFromUrl(r *http.Request) (int, error) {
-	matches := idRe.FindStringSubmatch(r.URL.Path)
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("no id in url")
+	idStr := router.Param(r, "id")
+	if idStr == "" {
+		return 0, problem.NotFound.WithDetail("no id in url")
 	}
-	id, err := strconv.Atoi(matches[1])
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		return 0, fmt.Errorf("id must be integer")
+		return 0, problem.BadRequest.Wrap(err).WithDetail("id must be integer")
 	}
 	return int(id), nil
 }
@@ -8,5 +8,8 @@ type Storage interface {
 	GetAll(ctx context.Context, login string) (Notes, error)
 	Update(ctx context.Context, note Note) error
 	Delete(ctx context.Context, id int) error
-	DeleteAll(ctx context.Context) error
+	DeleteAll(ctx context.Context, login string) error
+	ChangeAuthor(ctx context.Context, login string, newLogin string) error
+	Ping(ctx context.Context) error
+	Close() error
 }
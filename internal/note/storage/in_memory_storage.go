@@ -3,8 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
 	"github.com/Frank-Way/note-go-rest-service/internal/note"
-	"github.com/Frank-Way/note-go-rest-service/internal/note/nerror"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
 	"github.com/sirupsen/logrus"
 	"strconv"
 	"sync"
@@ -29,96 +30,132 @@ func NewInMemoryStorage(logger *logrus.Logger) note.Storage {
 }
 
 func (ims *inMemoryStorage) Save(ctx context.Context, note note.Note) (string, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("save note to in_memory_storage")
-	ims.logger.Debugf("use next id for note: %d", ims.nextId)
+	logger.Info("save note to in_memory_storage")
+	logger.Debugf("use next id for note: %d", ims.nextId)
 	note.Id = ims.nextId
-	note.Author = "no-author"
 	ims.notes[note.Id] = note
 	ims.nextId++
-	ims.logger.Debug("note was saved")
+	logger.Debug("note was saved")
 	return strconv.Itoa(int(note.Id)), nil
 }
 
 func (ims *inMemoryStorage) GetById(ctx context.Context, id int) (note.Note, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("get note from in_memory_storage")
-	ims.logger.Debugf("find note by id: %d", id)
+	logger.Info("get note from in_memory_storage")
+	logger.Debugf("find note by id: %d", id)
 	n, ok := ims.notes[id]
 	if ok {
-		ims.logger.Debug("note found")
+		logger.Debug("note found")
 		return n, nil
 	} else {
-		ims.logger.Debugf("note was not found, id: %d", id)
-		err := nerror.ErrorNotFound
-		err.Message = fmt.Sprintf("note with id '%d' not found", id)
-		return note.Note{}, err
+		logger.Debugf("note was not found, id: %d", id)
+		return note.Note{}, problem.NotFound.WithDetail(fmt.Sprintf("note with id '%d' not found", id))
 	}
 }
 
 func (ims *inMemoryStorage) GetAll(ctx context.Context, login string) (note.Notes, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("get notes from in_memory_storage")
+	logger.Info("get notes from in_memory_storage")
 	var res []note.Note
 	for _, v := range ims.notes {
 		if v.Author == login {
 			res = append(res, v)
 		}
 	}
-	ims.logger.Tracef("notes: %v", res)
-	ims.logger.Debug("notes found")
+	logger.Tracef("notes: %v", res)
+	logger.Debug("notes found")
 	return res, nil
 }
 
 func (ims *inMemoryStorage) Update(ctx context.Context, note note.Note) error {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("update note in in_memory_storage")
-	ims.logger.Debugf("find note by id: %d", note.Id)
+	logger.Info("update note in in_memory_storage")
+	logger.Debugf("find note by id: %d", note.Id)
 	n, ok := ims.notes[note.Id]
 	if ok {
-		ims.logger.Debug("note found")
-		ims.logger.Debug("update title and text")
+		logger.Debug("note found")
+		logger.Debug("update title and text")
 		n.Title = note.Title
 		n.Text = note.Text
 		ims.notes[n.Id] = n
-		ims.logger.Debug("note updated")
+		logger.Debug("note updated")
 		return nil
 	} else {
-		ims.logger.Debugf("note was not found, id: %d", n.Id)
-		err := nerror.ErrorNotFound
-		err.Message = fmt.Sprintf("note with id '%d' not found", n.Id)
-		return err
+		logger.Debugf("note was not found, id: %d", n.Id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("note with id '%d' not found", n.Id))
 	}
 }
 
 func (ims *inMemoryStorage) Delete(ctx context.Context, id int) error {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("delete note from in_memory_storage")
-	ims.logger.Debugf("find note by id: %d", id)
+	logger.Info("delete note from in_memory_storage")
+	logger.Debugf("find note by id: %d", id)
 	n, ok := ims.notes[id]
 	if ok {
-		ims.logger.Debug("note found")
+		logger.Debug("note found")
 		delete(ims.notes, n.Id)
-		ims.logger.Debug("note deleted")
+		logger.Debug("note deleted")
 		return nil
 	} else {
-		ims.logger.Debugf("note was not found, id: %d", id)
-		err := nerror.ErrorNotFound
-		err.Message = fmt.Sprintf("note with id '%d' not found", id)
-		return err
+		logger.Debugf("note was not found, id: %d", id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("note with id '%d' not found", id))
 	}
 }
 
-func (ims *inMemoryStorage) DeleteAll(ctx context.Context) error {
+func (ims *inMemoryStorage) DeleteAll(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("delete user's notes from in_memory_storage")
+	logger.Debugf("find notes by author: %s", login)
+	for id, n := range ims.notes {
+		if n.Author == login {
+			delete(ims.notes, id)
+		}
+	}
+	logger.Debug("notes deleted")
+	return nil
+}
+
+func (ims *inMemoryStorage) ChangeAuthor(ctx context.Context, login string, newLogin string) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("change notes author in in_memory_storage")
+	logger.Debugf("find notes by author: %s", login)
+	for id, n := range ims.notes {
+		if n.Author == login {
+			n.Author = newLogin
+			ims.notes[id] = n
+		}
+	}
+	logger.Debug("notes author changed")
+	return nil
+}
+
+func (ims *inMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ims *inMemoryStorage) Close() error {
+	ims.logger.Info("close note in_memory_storage")
 	return nil
 }
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/note"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+var _ note.Storage = &instrumentedStorage{}
+
+// instrumentedStorage records latency and spans of operations of wrapped storage.
+type instrumentedStorage struct {
+	storage note.Storage
+	backend string
+}
+
+func NewInstrumentedStorage(storage note.Storage, backend string) note.Storage {
+	return &instrumentedStorage{
+		storage: storage,
+		backend: backend,
+	}
+}
+
+func (is *instrumentedStorage) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, "note storage "+method,
+		attribute.String("storage.backend", is.backend))
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveStorage("note", is.backend, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (is *instrumentedStorage) Save(ctx context.Context, note note.Note) (string, error) {
+	ctx, done := is.start(ctx, "Save")
+	id, err := is.storage.Save(ctx, note)
+	done(err)
+	return id, err
+}
+
+func (is *instrumentedStorage) GetById(ctx context.Context, id int) (note.Note, error) {
+	ctx, done := is.start(ctx, "GetById")
+	n, err := is.storage.GetById(ctx, id)
+	done(err)
+	return n, err
+}
+
+func (is *instrumentedStorage) GetAll(ctx context.Context, login string) (note.Notes, error) {
+	ctx, done := is.start(ctx, "GetAll")
+	notes, err := is.storage.GetAll(ctx, login)
+	done(err)
+	return notes, err
+}
+
+func (is *instrumentedStorage) Update(ctx context.Context, note note.Note) error {
+	ctx, done := is.start(ctx, "Update")
+	err := is.storage.Update(ctx, note)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Delete(ctx context.Context, id int) error {
+	ctx, done := is.start(ctx, "Delete")
+	err := is.storage.Delete(ctx, id)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) DeleteAll(ctx context.Context, login string) error {
+	ctx, done := is.start(ctx, "DeleteAll")
+	err := is.storage.DeleteAll(ctx, login)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) ChangeAuthor(ctx context.Context, login string, newLogin string) error {
+	ctx, done := is.start(ctx, "ChangeAuthor")
+	err := is.storage.ChangeAuthor(ctx, login, newLogin)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Ping(ctx context.Context) error {
+	ctx, done := is.start(ctx, "Ping")
+	err := is.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Close() error {
+	return is.storage.Close()
+}
@@ -3,12 +3,16 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
 	"github.com/Frank-Way/note-go-rest-service/internal/note"
-	"github.com/Frank-Way/note-go-rest-service/internal/note/nerror"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
 	"github.com/go-redis/redis"
 	"github.com/sirupsen/logrus"
 	"net"
 	"strconv"
+	"time"
 )
 
 var _ note.Storage = &redisStorage{}
@@ -20,18 +24,18 @@ type redisStorage struct {
 
 const nextIdKey = ".nextId2"
 
-func NewRedisStorage(host, port, password string, db int, logger *logrus.Logger) (note.Storage, error) {
+func NewRedisStorage(host, port, password string, db int, timeout time.Duration, logger *logrus.Logger) (note.Storage, error) {
 	addr := net.JoinHostPort(host, port)
 	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
 	})
 	_, err := client.Ping().Result()
 	if err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB: " + addr
-		return nil, storeErr
+		return nil, problem.Storage.Wrap(fmt.Errorf("no connection to redis at %s: %w", addr, err))
 	}
 	return &redisStorage{
 		client: client,
@@ -44,123 +48,133 @@ type userAggregate struct {
 	NoteIds []int  `json:"notes_ids"`
 }
 
+// with returns client which traces commands as part of ctx.
+func (rs *redisStorage) with(ctx context.Context) *redis.Client {
+	return tracing.Redis(ctx, rs.client)
+}
+
 func (rs *redisStorage) Save(ctx context.Context, n note.Note) (string, error) {
-	rs.logger.Info("save note to redis")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return "", storeErr
-	}
-	rs.logger.Debugf("get new id from redis for note: %v", n)
-	nextIdStr, err := rs.client.Get(nextIdKey).Result()
-	if err != nil {
-		rs.logger.Debugf("error during getting next id: %v", err)
-		rs.logger.Debug("set next id to 1")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("save note to redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return "", problem.Storage.Wrap(err)
+	}
+	logger.Debugf("get new id from redis for note: %v", n)
+	nextIdStr, err := rs.with(ctx).Get(nextIdKey).Result()
+	if err != nil {
+		logger.Debugf("error during getting next id: %v", err)
+		logger.Debug("set next id to 1")
 		nextIdStr = "1"
-		err := rs.client.Set(nextIdKey, "2", 0).Err()
+		err := rs.with(ctx).Set(nextIdKey, "2", 0).Err()
 		if err != nil {
 			return "", err
 		}
 	}
-	rs.logger.Debugf("parse new id %s for note: %v", nextIdStr, n)
+	logger.Debugf("parse new id %s for note: %v", nextIdStr, n)
 	nextId, err := strconv.Atoi(nextIdStr)
 	if err != nil {
-		rs.logger.Debugf("error during parsing next id: %v", err)
+		logger.Debugf("error during parsing next id: %v", err)
 		return "", err
 	}
-	rs.logger.Debugf("set new id %d to note %v", nextId, n)
+	logger.Debugf("set new id %d to note %v", nextId, n)
 	n.Id = int(nextId)
-	rs.logger.Debug("incr id in redis")
-	rs.client.Incr(nextIdKey)
-	rs.logger.Debugf("marshaling note %v", n)
+	logger.Debug("incr id in redis")
+	rs.with(ctx).Incr(nextIdKey)
+	logger.Debugf("marshaling note %v", n)
 	bytes, err := json.Marshal(n)
 	if err != nil {
-		rs.logger.Debugf("error during marshaling note: %v", err)
+		logger.Debugf("error during marshaling note: %v", err)
 		return "", err
 	}
-	rs.logger.Debugf("save note in redis: %v", n)
-	if err := rs.client.Set(strconv.Itoa(int(n.Id)), bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving note: %v", err)
+	logger.Debugf("save note in redis: %v", n)
+	if err := rs.with(ctx).Set(strconv.Itoa(int(n.Id)), bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving note: %v", err)
 		return "", err
 	}
-	rs.logger.Debugf("get user's note aggregate for login: %q", n.Author)
-	aggrStr, err := rs.client.Get(n.Author).Result()
+	logger.Debugf("get user's note aggregate for login: %q", n.Author)
+	aggrStr, err := rs.with(ctx).Get(n.Author).Result()
 	if err != nil {
-		rs.logger.Debugf("error during getting aggregate: %v", err)
+		logger.Debugf("error during getting aggregate: %v", err)
 		aggrStr = "{\"login\":\"" + n.Author + "\",\"notes_ids\":[]}"
 	}
-	rs.logger.Debugf("unmarshal aggregate %q", aggrStr)
+	logger.Debugf("unmarshal aggregate %q", aggrStr)
 	var aggr userAggregate
 	err = json.Unmarshal([]byte(aggrStr), &aggr)
 	if err != nil {
 		return "", err
 	}
-	rs.logger.Debugf("append note %v to aggregate %v", n, aggr)
+	logger.Debugf("append note %v to aggregate %v", n, aggr)
 	aggr.NoteIds = append(aggr.NoteIds, n.Id)
-	rs.logger.Debugf("marshaling aggregate %v", aggr)
+	logger.Debugf("marshaling aggregate %v", aggr)
 	bytes, err = json.Marshal(aggr)
 	if err != nil {
-		rs.logger.Debugf("error during marshaling aggregate: %v", err)
+		logger.Debugf("error during marshaling aggregate: %v", err)
 		return "", err
 	}
-	rs.logger.Debugf("save aggregate to redis: %v", aggr)
-	if err = rs.client.Set(aggr.Login, bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving aggregate: %v", err)
+	logger.Debugf("save aggregate to redis: %v", aggr)
+	if err = rs.with(ctx).Set(aggr.Login, bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving aggregate: %v", err)
 		return "", err
 	}
 	return strconv.Itoa(int(n.Id)), nil
 }
 
 func (rs *redisStorage) GetById(ctx context.Context, id int) (note.Note, error) {
-	rs.logger.Info("get note from redis")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return note.Note{}, storeErr
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get note from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return note.Note{}, problem.Storage.Wrap(err)
+	}
+	noteStr, err := rs.with(ctx).Get(strconv.Itoa(int(id))).Result()
+	if err == redis.Nil {
+		logger.Debugf("note %d not found", id)
+		return note.Note{}, problem.NotFound.WithDetail(fmt.Sprintf("note with id '%d' not found", id))
 	}
-	noteStr, err := rs.client.Get(strconv.Itoa(int(id))).Result()
 	if err != nil {
-		rs.logger.Debugf("error during getting note: %v", err)
-		return note.Note{}, err
+		logger.Debugf("error during getting note: %v", err)
+		return note.Note{}, problem.Storage.Wrap(err)
 	}
-	rs.logger.Debugf("unmarshal note %q", noteStr)
+	logger.Debugf("unmarshal note %q", noteStr)
 	var n note.Note
 	err = json.Unmarshal([]byte(noteStr), &n)
 	if err != nil {
-		rs.logger.Debugf("error during unmarshaling note: %v", err)
+		logger.Debugf("error during unmarshaling note: %v", err)
 		return note.Note{}, err
 	}
 	return n, err
 }
 
 func (rs *redisStorage) GetAll(ctx context.Context, login string) (note.Notes, error) {
-	rs.logger.Info("get notes from redis")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return note.Notes{}, storeErr
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get notes from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return note.Notes{}, problem.Storage.Wrap(err)
+	}
+	logger.Debugf("get aggregate by login %q", login)
+	aggrStr, err := rs.with(ctx).Get(login).Result()
+	if err == redis.Nil {
+		logger.Debug("user has no notes")
+		return note.Notes{}, nil
 	}
-	rs.logger.Debugf("get aggregate by login %q", login)
-	aggrStr, err := rs.client.Get(login).Result()
 	if err != nil {
-		rs.logger.Debugf("error during getting aggregate %v", err)
-		return nil, err
+		logger.Debugf("error during getting aggregate %v", err)
+		return nil, problem.Storage.Wrap(err)
 	}
-	rs.logger.Debugf("unmarshal aggregate %q", aggrStr)
+	logger.Debugf("unmarshal aggregate %q", aggrStr)
 	var aggr userAggregate
 	err = json.Unmarshal([]byte(aggrStr), &aggr)
 	if err != nil {
-		rs.logger.Debugf("error during unmarshaling aggregate: %v", err)
+		logger.Debugf("error during unmarshaling aggregate: %v", err)
 		return note.Notes{}, err
 	}
-	rs.logger.Debugf("get notes by ids: %v", aggr)
-	var ns []note.Note
+	logger.Debugf("get notes by ids: %v", aggr)
+	ns := note.Notes{}
 	for i, nId := range aggr.NoteIds {
 		n, err := rs.GetById(ctx, nId)
-		rs.logger.Debugf("%d note.Id %d note %v", i, nId, n)
+		logger.Debugf("%d note.Id %d note %v", i, nId, n)
 		if err != nil {
 			return note.Notes{}, err
 		}
@@ -170,83 +184,183 @@ func (rs *redisStorage) GetAll(ctx context.Context, login string) (note.Notes, e
 }
 
 func (rs *redisStorage) Update(ctx context.Context, n note.Note) error {
-	rs.logger.Info("get notes from redis")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return storeErr
-	}
-	rs.logger.Debugf("marshaling note: %v", n)
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get notes from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return problem.Storage.Wrap(err)
+	}
+	logger.Debugf("marshaling note: %v", n)
 	bytes, err := json.Marshal(n)
 	if err != nil {
-		rs.logger.Debugf("error during marshaling note: %v", err)
+		logger.Debugf("error during marshaling note: %v", err)
 		return err
 	}
-	rs.logger.Debugf("save note to redis %v", n)
-	if err = rs.client.Set(strconv.Itoa(int(n.Id)), bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving note: %v", err)
+	logger.Debugf("save note to redis %v", n)
+	if err = rs.with(ctx).Set(strconv.Itoa(int(n.Id)), bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving note: %v", err)
 		return err
 	}
 	return nil
 }
 
 func (rs *redisStorage) Delete(ctx context.Context, id int) error {
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		storeErr := nerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return storeErr
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return problem.Storage.Wrap(err)
 	}
-	rs.logger.Debugf("get note from redis by id %d", id)
+	logger.Debugf("get note from redis by id %d", id)
 	n, err := rs.GetById(ctx, id)
 	if err != nil {
-		rs.logger.Debugf("error during getting note: %v", err)
+		logger.Debugf("error during getting note: %v", err)
 		return err
 	}
-	rs.logger.Debugf("got note %v", n)
-	rs.logger.Debugf("get user's note aggregate by login %q", n.Author)
-	aggrStr, err := rs.client.Get(n.Author).Result()
+	logger.Debugf("got note %v", n)
+	logger.Debugf("get user's note aggregate by login %q", n.Author)
+	aggrStr, err := rs.with(ctx).Get(n.Author).Result()
 	if err != nil {
-		rs.logger.Debugf("error during getting aggregate: %v", err)
+		logger.Debugf("error during getting aggregate: %v", err)
 		return err
 	}
-	rs.logger.Debugf("unmarshal aggregate %q", aggrStr)
+	logger.Debugf("unmarshal aggregate %q", aggrStr)
 	var aggr userAggregate
 	err = json.Unmarshal([]byte(aggrStr), &aggr)
 	if err != nil {
 		return err
 	}
-	rs.logger.Debugf("delete note from aggregate %v", aggr)
+	logger.Debugf("delete note from aggregate %v", aggr)
 	newAggr := userAggregate{
 		Login:   n.Author,
 		NoteIds: []int{},
 	}
-	rs.logger.Debugf("%v %d", aggr, n.Id)
+	logger.Debugf("%v %d", aggr, n.Id)
 	for _, nId := range aggr.NoteIds {
-		rs.logger.Debugf("%v %d", newAggr, nId)
+		logger.Debugf("%v %d", newAggr, nId)
 		if nId != n.Id {
 			newAggr.NoteIds = append(newAggr.NoteIds, nId)
 		}
 	}
-	rs.logger.Debugf("marshaling aggregate %v", newAggr)
+	logger.Debugf("marshaling aggregate %v", newAggr)
 	bytes, err := json.Marshal(newAggr)
 	if err != nil {
-		rs.logger.Debugf("error during marshaling aggregate: %v", err)
+		logger.Debugf("error during marshaling aggregate: %v", err)
+		return err
+	}
+	logger.Debugf("save aggregate to redis %v", newAggr)
+	if err = rs.with(ctx).Set(newAggr.Login, bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving aggregate: %v", err)
+		return err
+	}
+	if err = rs.with(ctx).Del(strconv.Itoa(id)).Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rs *redisStorage) DeleteAll(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("delete user's notes from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return problem.Storage.Wrap(err)
+	}
+	logger.Debugf("get user's note aggregate by login %q", login)
+	aggrStr, err := rs.with(ctx).Get(login).Result()
+	if err == redis.Nil {
+		logger.Debug("user has no notes")
+		return nil
+	} else if err != nil {
+		logger.Debugf("error during getting aggregate: %v", err)
 		return err
 	}
-	rs.logger.Debugf("save aggregate to redis %v", newAggr)
-	if err = rs.client.Set(newAggr.Login, bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving aggregate: %v", err)
+	logger.Debugf("unmarshal aggregate %q", aggrStr)
+	var aggr userAggregate
+	if err = json.Unmarshal([]byte(aggrStr), &aggr); err != nil {
+		logger.Debugf("error during unmarshaling aggregate: %v", err)
 		return err
 	}
-	if err = rs.client.Del(string(rune(id))).Err(); err != nil {
+	keys := []string{aggr.Login}
+	for _, nId := range aggr.NoteIds {
+		keys = append(keys, strconv.Itoa(nId))
+	}
+	logger.Debugf("delete notes and aggregate: %v", keys)
+	if err = rs.with(ctx).Del(keys...).Err(); err != nil {
+		logger.Debugf("error during deleting notes: %v", err)
 		return err
 	}
 	return nil
 }
 
-func (rs *redisStorage) DeleteAll(ctx context.Context) error {
-	//TODO implement me
-	panic("implement me")
+func (rs *redisStorage) ChangeAuthor(ctx context.Context, login string, newLogin string) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("change notes author in redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		return problem.Storage.Wrap(err)
+	}
+	logger.Debugf("move notes of %q to %q in transaction", login, newLogin)
+	return rs.with(ctx).Watch(func(tx *redis.Tx) error {
+		aggrStr, err := tx.Get(login).Result()
+		if err == redis.Nil {
+			logger.Debug("user has no notes")
+			return nil
+		} else if err != nil {
+			logger.Debugf("error during getting aggregate: %v", err)
+			return err
+		}
+		var aggr userAggregate
+		if err = json.Unmarshal([]byte(aggrStr), &aggr); err != nil {
+			logger.Debugf("error during unmarshaling aggregate: %v", err)
+			return err
+		}
+		keys := make([]string, 0, len(aggr.NoteIds))
+		for _, nId := range aggr.NoteIds {
+			keys = append(keys, strconv.Itoa(nId))
+		}
+		if len(keys) > 0 {
+			if err = tx.Watch(keys...).Err(); err != nil {
+				return err
+			}
+		}
+		notes := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			noteStr, err := tx.Get(key).Result()
+			if err != nil {
+				logger.Debugf("error during getting note %s: %v", key, err)
+				return err
+			}
+			var n note.Note
+			if err = json.Unmarshal([]byte(noteStr), &n); err != nil {
+				return err
+			}
+			n.Author = newLogin
+			if notes[key], err = json.Marshal(n); err != nil {
+				return err
+			}
+		}
+		aggr.Login = newLogin
+		aggrBytes, err := json.Marshal(aggr)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			for key, bytes := range notes {
+				pipe.Set(key, bytes, 0)
+			}
+			pipe.Set(newLogin, aggrBytes, 0)
+			pipe.Del(login)
+			return nil
+		})
+		return err
+	}, login, newLogin)
+}
+
+func (rs *redisStorage) Ping(ctx context.Context) error {
+	return rs.with(ctx).Ping().Err()
+}
+
+func (rs *redisStorage) Close() error {
+	rs.logger.Info("close note redis storage")
+	return rs.client.Close()
 }
@@ -0,0 +1,53 @@
+package note
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ Service = &tracingService{}
+
+// tracingService records span for every call of wrapped service.
+type tracingService struct {
+	service Service
+}
+
+func NewTracingService(service Service) Service {
+	return &tracingService{service: service}
+}
+
+func (ts *tracingService) CreateNote(ctx context.Context, dto CreateNoteDTO) (string, error) {
+	ctx, span := tracing.Start(ctx, "note.Service.CreateNote")
+	id, err := ts.service.CreateNote(ctx, dto)
+	tracing.End(span, err)
+	return id, err
+}
+
+func (ts *tracingService) UpdateNote(ctx context.Context, id int, dto UpdateNoteDTO) error {
+	ctx, span := tracing.Start(ctx, "note.Service.UpdateNote", attribute.Int("note.id", id))
+	err := ts.service.UpdateNote(ctx, id, dto)
+	tracing.End(span, err)
+	return err
+}
+
+func (ts *tracingService) GetNote(ctx context.Context, id int) (Note, error) {
+	ctx, span := tracing.Start(ctx, "note.Service.GetNote", attribute.Int("note.id", id))
+	n, err := ts.service.GetNote(ctx, id)
+	tracing.End(span, err)
+	return n, err
+}
+
+func (ts *tracingService) GetAllNotes(ctx context.Context) (Notes, error) {
+	ctx, span := tracing.Start(ctx, "note.Service.GetAllNotes")
+	notes, err := ts.service.GetAllNotes(ctx)
+	tracing.End(span, err)
+	return notes, err
+}
+
+func (ts *tracingService) DeleteNote(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "note.Service.DeleteNote", attribute.Int("note.id", id))
+	err := ts.service.DeleteNote(ctx, id)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,67 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/router"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type Handler struct {
+	service Service
+	logger  *logrus.Logger
+}
+
+func NewHandler(service Service, logger *logrus.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Register adds oidc routes to rt.
+func (h *Handler) Register(rt *router.Router) {
+	rt.Handle(http.MethodGet, "/api/v1/oidc/{provider:[A-Za-z0-9_-]+}/login", problem.Middleware(h.loginHandler, h.logger))
+	rt.Handle(http.MethodGet, "/api/v1/oidc/{provider:[A-Za-z0-9_-]+}/callback", problem.Middleware(h.callbackHandler, h.logger))
+}
+
+func (h *Handler) loginHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle oidc login request")
+	providerName := router.Param(r, "provider")
+	logger.Tracef("got provider '%s' from path '%s'", providerName, r.URL.Path)
+	logger.Debug("pass provider to service")
+	authUrl, err := h.service.AuthUrl(r.Context(), providerName)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	http.Redirect(w, r, authUrl, http.StatusFound)
+	return nil
+}
+
+func (h *Handler) callbackHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle oidc callback request")
+	providerName := router.Param(r, "provider")
+	logger.Tracef("got provider '%s' from path '%s'", providerName, r.URL.Path)
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		logger.Debugf("provider returned error %q: %s", errCode, query.Get("error_description"))
+	}
+	logger.Debug("pass code and state to service")
+	ctx := auth.WithClientInfo(r.Context(), auth.NewClientInfo(r))
+	token, err := h.service.Callback(ctx, providerName, query.Get("code"), query.Get("state"))
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user.TokenDTO{Token: token})
+	return nil
+}
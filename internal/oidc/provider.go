@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// provider is a relying party of single OpenID Connect provider. Discovery
+// document and signing keys are fetched lazily and keys are refetched when
+// token is signed by unknown key.
+type provider struct {
+	sync.Mutex
+	config    ProviderConfig
+	client    *http.Client
+	discovery *discoveryDocument
+	keys      map[string]interface{}
+	logger    *logrus.Logger
+}
+
+func newProvider(config ProviderConfig, client *http.Client, logger *logrus.Logger) *provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &provider{
+		config: config,
+		client: client,
+		logger: logger,
+	}
+}
+
+func (p *provider) authUrl(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientId)
+	query.Set("redirect_uri", p.config.RedirectUrl)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+func (p *provider) exchange(ctx context.Context, code, codeVerifier string) (tokenResponse, error) {
+	logger := logging.FromContext(ctx, p.logger)
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectUrl)
+	form.Set("client_id", p.config.ClientId)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+	}
+	logger.Debugf("exchange code at %s", doc.TokenEndpoint)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	var tokens tokenResponse
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return tokenResponse{}, err
+	}
+	if tokens.IdToken == "" {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned no id_token")
+	}
+	return tokens, nil
+}
+
+func (p *provider) verifyIdToken(ctx context.Context, idToken, nonce string) (*IdTokenClaims, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.ParseWithClaims(idToken, &IdTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*IdTokenClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid id_token")
+	}
+	if !claims.VerifyIssuer(doc.Issuer, true) {
+		return nil, fmt.Errorf("unexpected id_token issuer: %s", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientId, true) {
+		return nil, fmt.Errorf("id_token is not issued for client %s", p.config.ClientId)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+	return claims, nil
+}
+
+func (p *provider) getDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	logger := logging.FromContext(ctx, p.logger)
+	p.Lock()
+	defer p.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	logger.Debugf("fetch discovery document %s", wellKnown)
+	var doc discoveryDocument
+	if err := p.getJson(ctx, wellKnown, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Issuer != p.config.Issuer && doc.Issuer != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", doc.Issuer, p.config.Issuer)
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+func (p *provider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	logger := logging.FromContext(ctx, p.logger)
+	p.Lock()
+	key, ok := p.keys[kid]
+	p.Unlock()
+	if ok {
+		return key, nil
+	}
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("fetch signing keys %s", doc.JwksUri)
+	var set jsonWebKeySet
+	if err = p.getJson(ctx, doc.JwksUri, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logger.Debugf("skip key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.Lock()
+	p.keys = keys
+	p.Unlock()
+	if key, ok = keys[kid]; !ok {
+		if kid == "" && len(keys) == 1 {
+			for _, key = range keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *provider) getJson(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,179 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Service = &service{}
+
+const pendingAuthTTL = 10 * time.Minute
+
+type Service interface {
+	AuthUrl(ctx context.Context, providerName string) (string, error)
+	Callback(ctx context.Context, providerName string, code string, state string) (string, error)
+}
+
+type service struct {
+	providers map[string]*provider
+	users     user.Service
+	pending   *pendingAuths
+	logger    *logrus.Logger
+}
+
+type pendingAuths struct {
+	sync.Mutex
+	byState map[string]pendingAuth
+}
+
+func NewService(configs []ProviderConfig, users user.Service, logger *logrus.Logger) Service {
+	client := &http.Client{Timeout: 10 * time.Second}
+	providers := make(map[string]*provider, len(configs))
+	for _, config := range configs {
+		providers[config.Name] = newProvider(config, client, logger)
+	}
+	return &service{
+		providers: providers,
+		users:     users,
+		pending:   &pendingAuths{byState: make(map[string]pendingAuth)},
+		logger:    logger,
+	}
+}
+
+func (s service) AuthUrl(ctx context.Context, providerName string) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("start authorization with external identity provider")
+	p, err := s.getProvider(ctx, providerName)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("generate state, nonce and code verifier")
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	logger.Debug("build authorization url")
+	authUrl, err := p.authUrl(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		logger.Debugf("error during building authorization url: %v", err)
+		return "", problem.Storage.Wrap(err).WithDetail("identity provider is not available")
+	}
+	s.savePending(state, pendingAuth{
+		provider:     providerName,
+		codeVerifier: codeVerifier,
+		nonce:        nonce,
+		createdAt:    time.Now(),
+	})
+	return authUrl, nil
+}
+
+func (s service) Callback(ctx context.Context, providerName string, code string, state string) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("handle external identity provider callback")
+	p, err := s.getProvider(ctx, providerName)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("check state")
+	pending, ok := s.takePending(state)
+	if !ok || pending.provider != providerName {
+		logger.Debug("unknown or expired state")
+		return "", problem.Unauthorized.WithDetail("unknown or expired authorization request")
+	}
+	if code == "" {
+		logger.Debug("no code in callback")
+		return "", problem.Unauthorized.WithDetail("authorization was not granted")
+	}
+	logger.Debug("exchange code for tokens")
+	tokens, err := p.exchange(ctx, code, pending.codeVerifier)
+	if err != nil {
+		logger.Debugf("error during exchanging code: %v", err)
+		return "", problem.Unauthorized.Wrap(err)
+	}
+	logger.Debug("verify id token")
+	claims, err := p.verifyIdToken(ctx, tokens.IdToken, pending.nonce)
+	if err != nil {
+		logger.Debugf("error during verifying id token: %v", err)
+		return "", problem.Unauthorized.Wrap(err)
+	}
+	preferredLogin := claims.PreferredUsername
+	if preferredLogin == "" && claims.Email != "" {
+		preferredLogin = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	logger.Debug("pass external identity to user service")
+	return s.users.SignInExternal(ctx, user.ExternalSignInDTO{
+		Identity: user.ExternalIdentity{
+			Provider: providerName,
+			Subject:  claims.Subject,
+		},
+		PreferredLogin: preferredLogin,
+		Email:          claims.Email,
+		DisplayName:    claims.Name,
+	})
+}
+
+func (s service) getProvider(ctx context.Context, name string) (*provider, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	p, ok := s.providers[name]
+	if !ok {
+		logger.Debugf("unknown identity provider %q", name)
+		return nil, problem.NotFound.WithDetail(fmt.Sprintf("identity provider '%s' not found", name))
+	}
+	return p, nil
+}
+
+func (s service) savePending(state string, auth pendingAuth) {
+	s.pending.Lock()
+	defer s.pending.Unlock()
+
+	now := time.Now()
+	for st, a := range s.pending.byState {
+		if now.Sub(a.createdAt) > pendingAuthTTL {
+			delete(s.pending.byState, st)
+		}
+	}
+	s.pending.byState[state] = auth
+}
+
+func (s service) takePending(state string) (pendingAuth, bool) {
+	s.pending.Lock()
+	defer s.pending.Unlock()
+
+	auth, ok := s.pending.byState[state]
+	if !ok {
+		return pendingAuth{}, false
+	}
+	delete(s.pending.byState, state)
+	if time.Since(auth.createdAt) > pendingAuthTTL {
+		return pendingAuth{}, false
+	}
+	return auth, true
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,401 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	authStorage "github.com/Frank-Way/note-go-rest-service/internal/auth/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail/mailer"
+	noteStorage "github.com/Frank-Way/note-go-rest-service/internal/note/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/Frank-Way/note-go-rest-service/internal/user/authenticator"
+	userStorage "github.com/Frank-Way/note-go-rest-service/internal/user/storage"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testProvider = "test"
+	testClientId = "note-service"
+	testKeyId    = "key-1"
+)
+
+// fakeProvider is an OpenID Connect provider serving discovery document,
+// signing keys and token endpoint. It remembers authorization requests by
+// code, so that token endpoint can check PKCE and put nonce to id_token.
+type fakeProvider struct {
+	sync.Mutex
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// issuer is returned in discovery document, server url by default
+	issuer string
+	// claims modifies id_token claims before signing
+	claims   func(claims *IdTokenClaims)
+	requests map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	fp := &fakeProvider{key: key, requests: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", fp.discovery)
+	mux.HandleFunc("/jwks", fp.jwks)
+	mux.HandleFunc("/token", fp.token)
+	fp.server = httptest.NewServer(mux)
+	fp.issuer = fp.server.URL
+	t.Cleanup(fp.server.Close)
+	return fp
+}
+
+func (fp *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, discoveryDocument{
+		Issuer:                fp.issuer,
+		AuthorizationEndpoint: fp.server.URL + "/authorize",
+		TokenEndpoint:         fp.server.URL + "/token",
+		JwksUri:               fp.server.URL + "/jwks",
+	})
+}
+
+func (fp *fakeProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, jsonWebKeySet{Keys: []jsonWebKey{{
+		Kid: testKeyId,
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(fp.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(fp.key.E)).Bytes()),
+	}}})
+}
+
+func (fp *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	fp.Lock()
+	request, ok := fp.requests[r.PostForm.Get("code")]
+	delete(fp.requests, r.PostForm.Get("code"))
+	claims := fp.claims
+	fp.Unlock()
+	if !ok || r.PostForm.Get("client_id") != testClientId {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if request.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != request.Get("code_challenge") {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	idClaims := &IdTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    fp.issuer,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{testClientId},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce:             request.Get("nonce"),
+		Email:             "alice@example.org",
+		Name:              "Alice",
+		PreferredUsername: "alice",
+	}
+	if claims != nil {
+		claims(idClaims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = testKeyId
+	idToken, err := token.SignedString(fp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, tokenResponse{AccessToken: "access", IdToken: idToken, TokenType: "Bearer"})
+}
+
+// authorize plays user consenting at authorization endpoint, it returns code
+// and state the provider redirects back with.
+func (fp *fakeProvider) authorize(t *testing.T, authUrl string) (string, string) {
+	t.Helper()
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("parse authorization url: %v", err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testClientId || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request: %s", authUrl)
+	}
+	code, err := randomString()
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	fp.Lock()
+	fp.requests[code] = query
+	fp.Unlock()
+	return code, query.Get("state")
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type testEnv struct {
+	provider *fakeProvider
+	service  Service
+	authSrv  auth.Service
+	users    user.Storage
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	fp := newFakeProvider(t)
+	authSrv := auth.NewAuthService(authStorage.NewInMemorySessionStorage(logger), logger)
+	uStorage := userStorage.NewInMemoryStorage(logger)
+	uService := user.NewService(authSrv, uStorage, authenticator.NewStoreAuthenticator(uStorage, logger),
+		noteStorage.NewInMemoryStorage(logger), nil, mailer.NewLogMailer(logger), user.Options{}, logger)
+	service := NewService([]ProviderConfig{{
+		Name:        testProvider,
+		Issuer:      fp.server.URL,
+		ClientId:    testClientId,
+		RedirectUrl: "http://localhost/callback",
+	}}, uService, logger)
+	return &testEnv{provider: fp, service: service, authSrv: authSrv, users: uStorage}
+}
+
+// signIn goes through authorization code flow and returns service's token.
+func (e *testEnv) signIn(t *testing.T) (string, error) {
+	t.Helper()
+	authUrl, err := e.service.AuthUrl(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("get authorization url: %v", err)
+	}
+	code, state := e.provider.authorize(t, authUrl)
+	return e.service.Callback(context.Background(), testProvider, code, state)
+}
+
+func (e *testEnv) login(t *testing.T, token string) string {
+	t.Helper()
+	claims, err := e.authSrv.ParseTokenClaims(context.Background(), token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	return claims.UserLogin
+}
+
+func TestAuthUrl(t *testing.T) {
+	e := newTestEnv(t)
+	authUrl, err := e.service.AuthUrl(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("parse authorization url: %v", err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" {
+		t.Errorf("authorization endpoint = %q, want /authorize", u.Path)
+	}
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(name) == "" {
+			t.Errorf("authorization url has no %s", name)
+		}
+	}
+	if method := query.Get("code_challenge_method"); method != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", method)
+	}
+
+	if _, err = e.service.AuthUrl(context.Background(), "unknown"); !errors.Is(err, problem.NotFound) {
+		t.Errorf("unknown provider: error = %v, want not found", err)
+	}
+}
+
+func TestCallback_ProvisionsUser(t *testing.T) {
+	e := newTestEnv(t)
+	token, err := e.signIn(t)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if login := e.login(t, token); login != "alice" {
+		t.Errorf("login = %q, want alice", login)
+	}
+	u, err := e.users.GetByExternalIdentity(context.Background(),
+		user.ExternalIdentity{Provider: testProvider, Subject: "subject-1"})
+	if err != nil {
+		t.Fatalf("provisioned user not found: %v", err)
+	}
+	if u.Login != "alice" || u.Email != "alice@example.org" || u.DisplayName != "Alice" || !u.IsActive {
+		t.Errorf("unexpected provisioned user: %+v", u)
+	}
+
+	token, err = e.signIn(t)
+	if err != nil {
+		t.Fatalf("second sign in: unexpected error: %v", err)
+	}
+	if login := e.login(t, token); login != "alice" {
+		t.Errorf("second sign in: login = %q, want alice", login)
+	}
+	users, err := e.users.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("get users: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("got %d users after second sign in, want 1", len(users))
+	}
+}
+
+func TestCallback_ProvisionsUserWithFreeLogin(t *testing.T) {
+	e := newTestEnv(t)
+	if _, err := e.users.Save(context.Background(), user.User{Login: "alice", Password: "Passw0rd!x", IsActive: true}); err != nil {
+		t.Fatalf("save local user: %v", err)
+	}
+	e.provider.claims = func(claims *IdTokenClaims) {
+		claims.PreferredUsername = "alice@example.org"
+	}
+	token, err := e.signIn(t)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if login := e.login(t, token); login != "alice_example_org" {
+		t.Errorf("login = %q, want alice_example_org", login)
+	}
+
+	e.provider.claims = func(claims *IdTokenClaims) {
+		claims.Subject = "subject-2"
+		claims.PreferredUsername = ""
+	}
+	token, err = e.signIn(t)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if login := e.login(t, token); login != "alice_2" {
+		t.Errorf("login derived from email = %q, want alice_2", login)
+	}
+}
+
+func TestCallback_RejectsInvalidIdToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims *IdTokenClaims)
+	}{
+		{
+			name: "issuer mismatch",
+			claims: func(claims *IdTokenClaims) {
+				claims.Issuer = "https://evil.example.org"
+			},
+		},
+		{
+			name: "audience mismatch",
+			claims: func(claims *IdTokenClaims) {
+				claims.Audience = jwt.ClaimStrings{"another-client"}
+			},
+		},
+		{
+			name: "nonce mismatch",
+			claims: func(claims *IdTokenClaims) {
+				claims.Nonce = "another-nonce"
+			},
+		},
+		{
+			name: "expired",
+			claims: func(claims *IdTokenClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name: "no subject",
+			claims: func(claims *IdTokenClaims) {
+				claims.Subject = ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			e.provider.claims = tt.claims
+			if _, err := e.signIn(t); !errors.Is(err, problem.Unauthorized) {
+				t.Errorf("error = %v, want unauthorized", err)
+			}
+			users, err := e.users.GetAll(context.Background())
+			if err != nil {
+				t.Fatalf("get users: %v", err)
+			}
+			if len(users) != 0 {
+				t.Errorf("got %d users, want none to be provisioned", len(users))
+			}
+		})
+	}
+}
+
+func TestCallback_RejectsDiscoveryIssuerMismatch(t *testing.T) {
+	e := newTestEnv(t)
+	e.provider.issuer = "https://evil.example.org"
+	if _, err := e.service.AuthUrl(context.Background(), testProvider); err == nil {
+		t.Error("expected error for discovery document of another issuer")
+	}
+}
+
+func TestCallback_ChecksState(t *testing.T) {
+	e := newTestEnv(t)
+	authUrl, err := e.service.AuthUrl(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("get authorization url: %v", err)
+	}
+	code, state := e.provider.authorize(t, authUrl)
+
+	if _, err = e.service.Callback(context.Background(), testProvider, code, "unknown"); !errors.Is(err, problem.Unauthorized) {
+		t.Errorf("unknown state: error = %v, want unauthorized", err)
+	}
+	if _, err = e.service.Callback(context.Background(), testProvider, code, state); err != nil {
+		t.Fatalf("valid state: unexpected error: %v", err)
+	}
+	if _, err = e.service.Callback(context.Background(), testProvider, code, state); !errors.Is(err, problem.Unauthorized) {
+		t.Errorf("reused state: error = %v, want unauthorized", err)
+	}
+
+	authUrl, err = e.service.AuthUrl(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("get authorization url: %v", err)
+	}
+	_, state = e.provider.authorize(t, authUrl)
+	if _, err = e.service.Callback(context.Background(), testProvider, "", state); !errors.Is(err, problem.Unauthorized) {
+		t.Errorf("no code: error = %v, want unauthorized", err)
+	}
+}
+
+func TestCallback_ChecksCodeVerifier(t *testing.T) {
+	e := newTestEnv(t)
+	authUrl, err := e.service.AuthUrl(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("get authorization url: %v", err)
+	}
+	code, state := e.provider.authorize(t, authUrl)
+	e.provider.Lock()
+	challenge := sha256.Sum256([]byte("another verifier"))
+	e.provider.requests[code].Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	e.provider.Unlock()
+	if _, err = e.service.Callback(context.Background(), testProvider, code, state); !errors.Is(err, problem.Unauthorized) {
+		t.Errorf("error = %v, want unauthorized", err)
+	}
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// swaggerUI holds assets of Swagger UI, so that docs do not depend on CDN.
+//
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+var swaggerAssets = func() http.Handler {
+	assets, _ := fs.Sub(swaggerUI, "swagger-ui")
+	return http.StripPrefix("/docs/", http.FileServer(http.FS(assets)))
+}()
+
+// DocsHandler serves Swagger UI page rendering the spec at /docs and its
+// assets below /docs/.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/docs" {
+		swaggerAssets.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(swaggerPage)
+}
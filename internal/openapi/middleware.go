@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Middleware rejects requests which do not match the spec with validation
+// problem listing invalid parameters. Requests to operations missing in the
+// spec are passed as is. Nil validator passes all requests.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	if v == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context(), v.logger)
+
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			logger.Tracef("request is not described by api spec: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if body := route.Operation.RequestBody; body != nil && body.Value != nil && r.ContentLength != 0 {
+			if contentType := r.Header.Get("Content-Type"); body.Value.Content.Get(contentType) == nil {
+				logger.Debugf("content type %s is not described by api spec", contentType)
+				problem.Write(w, r, problem.UnsupportedMediaType.WithDetail(
+					fmt.Sprintf("content type %s is not supported", contentType)), v.logger)
+				return
+			}
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// authentication is checked by handlers
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Write(w, r, problem.MalformedBody(err), v.logger)
+				return
+			}
+			logger.Debugf("request does not match api spec: %v", err)
+			var params []problem.InvalidParam
+			collect(err, "", &params)
+			problem.Write(w, r, problem.Validation.
+				WithDetail("request does not match api spec").
+				WithInvalidParams(params), v.logger)
+			return
+		}
+
+		if !v.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+
+		output := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 bw.status,
+			Header:                 w.Header(),
+			Options: &openapi3filter.Options{
+				MultiError:            true,
+				IncludeResponseStatus: true,
+			},
+		}
+		output.SetBodyBytes(bw.body.Bytes())
+		if err := openapi3filter.ValidateResponse(r.Context(), output); err != nil {
+			logger.Warnf("response does not match api spec: %v", err)
+		}
+
+		w.WriteHeader(bw.status)
+		w.Write(bw.body.Bytes())
+	})
+}
+
+// collect flattens validation errors into invalid params named after
+// location of the rejected value, e.g. path.login or body/password.
+func collect(err error, name string, params *[]problem.InvalidParam) {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, err := range e {
+			collect(err, name, params)
+		}
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			name = e.Parameter.In + "." + e.Parameter.Name
+		} else if e.RequestBody != nil {
+			name = "body"
+		}
+		if e.Err == nil {
+			*params = append(*params, problem.InvalidParam{Name: name, Reason: e.Reason})
+			return
+		}
+		collect(e.Err, name, params)
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			name += "/" + strings.Join(pointer, "/")
+		}
+		*params = append(*params, problem.InvalidParam{Name: name, Reason: e.Reason})
+	default:
+		if name == "" {
+			name = "request"
+		}
+		*params = append(*params, problem.InvalidParam{Name: name, Reason: err.Error()})
+	}
+}
+
+// bufferedWriter holds response until it is validated. Headers are written
+// to the underlying writer directly.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	bw.status = status
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedWriter) ReadFrom(r io.Reader) (int64, error) {
+	return bw.body.ReadFrom(r)
+}
@@ -0,0 +1,109 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+type Options struct {
+	Spec *Spec
+	// ValidateResponses logs responses which do not match the spec, it is
+	// meant for development since every response is buffered.
+	ValidateResponses bool
+	// Codecs decode bodies of media types validator does not support.
+	Codecs []codec.Codec
+}
+
+// Spec is the OpenAPI spec of the service.
+type Spec struct {
+	doc  *openapi3.T
+	json []byte
+}
+
+func LoadSpec(path string, logger *logrus.Logger) (*Spec, error) {
+	logger.Debugf("loading api spec from %s", path)
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error during loading api spec: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("api spec is invalid: %v", err)
+	}
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error during marshalling api spec: %v", err)
+	}
+	return &Spec{doc: doc, json: spec}, nil
+}
+
+// Handler serves the spec as JSON.
+func (s *Spec) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.json)
+}
+
+// Validator checks requests against the OpenAPI spec of the service.
+type Validator struct {
+	router            routers.Router
+	validateResponses bool
+	logger            *logrus.Logger
+}
+
+func NewValidator(options Options, logger *logrus.Logger) (*Validator, error) {
+	// servers of the spec are examples for clients, requests are matched
+	// regardless of host the service is reached by
+	routed := *options.Spec.doc
+	routed.Servers = nil
+	router, err := gorillamux.NewRouter(&routed)
+	if err != nil {
+		return nil, fmt.Errorf("error during building api spec router: %v", err)
+	}
+
+	for _, c := range options.Codecs {
+		registerBodyDecoder(c)
+	}
+
+	return &Validator{
+		router:            router,
+		validateResponses: options.ValidateResponses,
+		logger:            logger,
+	}, nil
+}
+
+func registerBodyDecoder(c codec.Codec) {
+	for _, mediaType := range append(c.MediaTypes(), codec.ProblemType(c)) {
+		if openapi3filter.RegisteredBodyDecoder(mediaType) != nil {
+			continue
+		}
+		openapi3filter.RegisterBodyDecoder(mediaType, func(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+			var value interface{}
+			if err := c.Decode(body, &value); err != nil {
+				return nil, err
+			}
+			// schema checks expect values as decoded from json, e.g.
+			// float64 numbers
+			jsonBytes, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			value = nil
+			err = json.Unmarshal(jsonBytes, &value)
+			return value, err
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type appHandler func(w http.ResponseWriter, r *http.Request) error
+
+// Middleware writes error returned by h as problem details, errors which
+// are not problems are reported as internal errors.
+func Middleware(h appHandler, logger *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := h(w, r)
+		if err == nil {
+			return
+		}
+		Write(w, r, err, logger)
+	}
+}
+
+// Write sends err to client as problem details.
+func Write(w http.ResponseWriter, r *http.Request, err error, logger *logrus.Logger) {
+	var p *Problem
+	if errors.Is(err, context.DeadlineExceeded) {
+		p = Timeout.Wrap(err)
+	} else if errors.As(err, &p) {
+		c := *p
+		p = &c
+	} else {
+		p = Internal.Wrap(err)
+	}
+	p.Instance = r.URL.Path
+	entry := logging.FromContext(r.Context(), logger)
+	if p.Status >= http.StatusInternalServerError {
+		entry.Errorf("error during handling request: %v (cause: %v)", p, p.Err)
+	} else {
+		entry.Debugf("request failed: %v (cause: %v)", p, p.Err)
+	}
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.RetryAfter.Seconds()))))
+	}
+	contentType, body := ContentType, p.Marshal()
+	if encode, ok := r.Context().Value(encoderKey{}).(Encoder); ok {
+		if ct, b, err := encode(p); err != nil {
+			entry.Warnf("error during encoding problem, send it as json: %v", err)
+		} else {
+			contentType, body = ct, b
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// Encoder encodes problem in format negotiated with client and returns
+// content type of the body.
+type Encoder func(p *Problem) (string, []byte, error)
+
+type encoderKey struct{}
+
+// WithEncoder returns context of requests which problems are encoded by enc
+// instead of json.
+func WithEncoder(ctx context.Context, enc Encoder) context.Context {
+	return context.WithValue(ctx, encoderKey{}, enc)
+}
@@ -0,0 +1,130 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TypeBase prefixes error codes to build type URIs of problems.
+const TypeBase = "https://github.com/Frank-Way/note-go-rest-service/problems/"
+
+const ContentType = "application/problem+json"
+
+var (
+	BadRequest           = New("bad_request", http.StatusBadRequest, "Bad request")
+	Validation           = New("validation_error", http.StatusUnprocessableEntity, "Validation error")
+	PasswordsMismatch    = New("passwords_mismatch", http.StatusUnprocessableEntity, "Passwords mismatch")
+	Unauthorized         = New("unauthorized", http.StatusUnauthorized, "Not authorized")
+	WrongCredentials     = New("wrong_credentials", http.StatusUnauthorized, "Wrong credentials")
+	Forbidden            = New("forbidden", http.StatusForbidden, "Access denied")
+	NotVerified          = New("not_verified", http.StatusForbidden, "Email is not verified")
+	NotFound             = New("not_found", http.StatusNotFound, "Resource not found")
+	MethodNotAllowed     = New("method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed")
+	PayloadTooLarge      = New("payload_too_large", http.StatusRequestEntityTooLarge, "Request body is too large")
+	NotAcceptable        = New("not_acceptable", http.StatusNotAcceptable, "Not acceptable")
+	UnsupportedMediaType = New("unsupported_media_type", http.StatusUnsupportedMediaType, "Unsupported media type")
+	Conflict             = New("already_exists", http.StatusConflict, "Resource already exists")
+	TooManyRequests      = New("too_many_requests", http.StatusTooManyRequests, "Too many requests")
+	AlreadyVerified      = New("already_verified", http.StatusConflict, "Email is already verified")
+	Storage              = New("storage_error", http.StatusInternalServerError, "Storage error")
+	Timeout              = New("timeout", http.StatusServiceUnavailable, "Request timed out")
+	Unavailable          = New("unavailable", http.StatusServiceUnavailable, "Service is temporarily unavailable")
+	Internal             = New("internal_error", http.StatusInternalServerError, "Internal server error")
+)
+
+// Problem is an error reported to clients as RFC 7807 problem details.
+// Problems are matched by code, so errors.Is(err, problem.NotFound) holds
+// for every not found problem regardless of its detail.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// InvalidParams lists rejected request parameters and body fields.
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	// RetryAfter is sent in Retry-After header when set.
+	RetryAfter time.Duration `json:"-"`
+	// Err is the cause of the problem, it is logged but not sent to clients.
+	Err error `json:"-"`
+}
+
+// InvalidParam describes why request parameter or body field was rejected.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func New(code string, status int, title string) *Problem {
+	return &Problem{
+		Type:   TypeBase + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error { return p.Err }
+
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code == p.Code
+}
+
+// WithDetail returns copy of the problem with explanation specific to this
+// occurrence.
+func (p *Problem) WithDetail(detail string) *Problem {
+	c := *p
+	c.Detail = detail
+	return &c
+}
+
+// WithInvalidParams returns copy of the problem listing rejected parameters.
+func (p *Problem) WithInvalidParams(params []InvalidParam) *Problem {
+	c := *p
+	c.InvalidParams = params
+	return &c
+}
+
+// WithRetryAfter returns copy of the problem telling clients when to retry.
+func (p *Problem) WithRetryAfter(d time.Duration) *Problem {
+	c := *p
+	c.RetryAfter = d
+	return &c
+}
+
+// Wrap returns copy of the problem caused by err.
+func (p *Problem) Wrap(err error) *Problem {
+	c := *p
+	c.Err = err
+	return &c
+}
+
+func (p *Problem) Marshal() []byte {
+	marshal, err := json.Marshal(p)
+	if err != nil {
+		return nil
+	}
+	return marshal
+}
+
+// MalformedBody reports error of decoding request body, bodies exceeding
+// size limit are reported as PayloadTooLarge.
+func MalformedBody(err error) *Problem {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return PayloadTooLarge.Wrap(err).WithDetail(fmt.Sprintf("request body must be at most %d bytes", maxBytesErr.Limit))
+	}
+	return BadRequest.Wrap(err).WithDetail("malformed request body")
+}
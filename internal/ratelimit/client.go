@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// localKey identifies anonymous clients which have no address, e.g. peers
+// of unix socket without forwarded address. They share one bucket.
+const localKey = "local"
+
+// ClientOptions tells how anonymous clients are identified. Client address
+// is taken from ForwardedHeader of requests sent by TrustedProxies or
+// through unix socket, since only local processes may connect to it.
+type ClientOptions struct {
+	TrustedProxies []*net.IPNet
+	// ForwardedHeader holds client address appended by every proxy, e.g.
+	// X-Forwarded-For. Addresses are not forwarded when it is empty.
+	ForwardedHeader string
+}
+
+// ParseTrustedProxies parses ip addresses and CIDR ranges of proxies.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address of trusted proxy: %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range of trusted proxies: %w", err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// clientKey returns address of anonymous client. Forwarded addresses are
+// walked from the nearest proxy, so that the first untrusted address is
+// taken and clients can not pick their key by sending the header.
+func (o ClientOptions) clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer != nil && !o.trusted(peer) {
+		return peer.String()
+	}
+	if o.ForwardedHeader != "" {
+		forwarded := strings.Split(strings.Join(r.Header.Values(o.ForwardedHeader), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if ip == nil {
+				break
+			}
+			peer = ip
+			if !o.trusted(ip) {
+				break
+			}
+		}
+	}
+	if peer == nil {
+		return localKey
+	}
+	return peer.String()
+}
+
+func (o ClientOptions) trusted(ip net.IP) bool {
+	for _, proxy := range o.TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
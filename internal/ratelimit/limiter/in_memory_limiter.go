@@ -0,0 +1,86 @@
+package limiter
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ ratelimit.Limiter = &inMemoryLimiter{}
+
+// sweepInterval is how often buckets which are full again are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   ratelimit.Limit
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(b.limit.Capacity()), b.tokens+elapsed*b.limit.Rate())
+	b.updated = now
+}
+
+type inMemoryLimiter struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	logger    *logrus.Logger
+}
+
+func NewInMemoryLimiter(logger *logrus.Logger) ratelimit.Limiter {
+	return &inMemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+		logger:    logger,
+	}
+}
+
+func (l *inMemoryLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	logger := logging.FromContext(ctx, l.logger)
+	logger.Tracef("take token from bucket %s", key)
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Capacity()), updated: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return ratelimit.NewResult(allowed, b.tokens, limit), nil
+}
+
+func (l *inMemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Capacity()) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *inMemoryLimiter) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (l *inMemoryLimiter) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit"
+	"github.com/sirupsen/logrus"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by tests instead of waiting for buckets to refill.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter() (*inMemoryLimiter, *fakeClock) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewInMemoryLimiter(logger).(*inMemoryLimiter)
+	l.now = clock.Now
+	l.lastSweep = clock.now
+	return l, clock
+}
+
+func TestInMemoryLimiter_Allow(t *testing.T) {
+	// a token per second, up to 3 at once
+	limit := ratelimit.Limit{Requests: 60, Period: time.Minute, Burst: 3}
+	type step struct {
+		advance    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst is allowed",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0, retryAfter: time.Second},
+				{allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "bucket refills at rate",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0, retryAfter: time.Second},
+				{advance: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, allowed: true, remaining: 0, retryAfter: time.Second},
+				{advance: 2 * time.Second, allowed: true, remaining: 1},
+			},
+		},
+		{
+			name: "bucket does not exceed capacity",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{advance: time.Hour, allowed: true, remaining: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, clock := newTestLimiter()
+			for i, s := range tt.steps {
+				clock.now = clock.now.Add(s.advance)
+				result, err := l.Allow(context.Background(), "key", limit)
+				if err != nil {
+					t.Fatalf("step %d: unexpected error: %v", i, err)
+				}
+				if result.Allowed != s.allowed || result.Remaining != s.remaining || result.RetryAfter != s.retryAfter {
+					t.Errorf("step %d: result = %+v, want allowed %v, remaining %d, retry after %s",
+						i, result, s.allowed, s.remaining, s.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryLimiter_KeysAreSeparate(t *testing.T) {
+	l, _ := newTestLimiter()
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	for _, key := range []string{"auth:user:alice", "auth:user:bob", "auth:ip:192.0.2.1"} {
+		if result, _ := l.Allow(context.Background(), key, limit); !result.Allowed {
+			t.Errorf("first request of %s is rejected", key)
+		}
+	}
+	if result, _ := l.Allow(context.Background(), "auth:user:alice", limit); result.Allowed {
+		t.Error("second request of alice is allowed")
+	}
+}
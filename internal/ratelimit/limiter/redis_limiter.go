@@ -0,0 +1,94 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"time"
+)
+
+var _ ratelimit.Limiter = &redisLimiter{}
+
+const bucketKeyPrefix = ".ratelimit:"
+
+// takeToken refills bucket stored as hash of tokens and update time in
+// milliseconds and takes a token from it atomically, so that instances
+// sharing Redis share limits. Buckets expire once they are full again.
+var takeToken = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+type redisLimiter struct {
+	client *redis.Client
+	logger *logrus.Logger
+}
+
+func NewRedisLimiter(host, port, password string, db int, timeout time.Duration, logger *logrus.Logger) (ratelimit.Limiter, error) {
+	addr := net.JoinHostPort(host, port)
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+	_, err := client.Ping().Result()
+	if err != nil {
+		return nil, fmt.Errorf("no connection to Redis DB: %s", addr)
+	}
+	return &redisLimiter{
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+func (rl *redisLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	logger := logging.FromContext(ctx, rl.logger)
+	logger.Tracef("take token from bucket %s in redis", key)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	reply, err := takeToken.Run(tracing.Redis(ctx, rl.client), []string{bucketKeyPrefix + key},
+		limit.Capacity(), strconv.FormatFloat(limit.Rate(), 'f', -1, 64), now).Result()
+	if err != nil {
+		logger.Debugf("error during running rate limit script: %v", err)
+		return ratelimit.Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return ratelimit.Result{}, fmt.Errorf("unexpected reply of rate limit script: %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("unexpected reply of rate limit script: %v", reply)
+	}
+	return ratelimit.NewResult(allowed == 1, tokens, limit), nil
+}
+
+func (rl *redisLimiter) Ping(ctx context.Context) error {
+	return tracing.Redis(ctx, rl.client).Ping().Err()
+}
+
+func (rl *redisLimiter) Close() error {
+	return rl.client.Close()
+}
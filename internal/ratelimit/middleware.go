@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultGroup limits requests to routes which are not listed in any group.
+const defaultGroup = "default"
+
+// Group limits requests to routes given as "METHOD /route/{template}", "*"
+// matches any method.
+type Group struct {
+	Name   string
+	Limit  Limit
+	Routes []string
+}
+
+// Middleware limits requests of every client separately, clients are
+// identified by login when authenticated and by ip otherwise.
+type Middleware struct {
+	limiter Limiter
+	groups  map[string]Group
+	byRoute map[string]string
+	clients ClientOptions
+	route   func(path string) string
+	logger  *logrus.Logger
+}
+
+// NewMiddleware creates middleware limiting requests by groups, route maps
+// request paths to route templates. Group named "default" applies to routes
+// missing in other groups, without it such routes are not limited.
+func NewMiddleware(limiter Limiter, groups []Group, clients ClientOptions, route func(path string) string,
+	logger *logrus.Logger) *Middleware {
+	m := &Middleware{
+		limiter: limiter,
+		groups:  make(map[string]Group),
+		byRoute: make(map[string]string),
+		clients: clients,
+		route:   route,
+		logger:  logger,
+	}
+	for _, g := range groups {
+		m.groups[g.Name] = g
+		for _, r := range g.Routes {
+			m.byRoute[r] = g.Name
+		}
+	}
+	return m
+}
+
+func (m *Middleware) group(r *http.Request) (Group, bool) {
+	template := m.route(r.URL.Path)
+	name, ok := m.byRoute[r.Method+" "+template]
+	if !ok {
+		name, ok = m.byRoute["* "+template]
+	}
+	if !ok {
+		name = defaultGroup
+	}
+	g, ok := m.groups[name]
+	return g, ok
+}
+
+// Limit rejects requests exceeding limit of their group. Nil middleware
+// passes all requests.
+func (m *Middleware) Limit(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context(), m.logger)
+		g, ok := m.group(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := g.Name + ":ip:" + m.clients.clientKey(r)
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+			key = g.Name + ":user:" + p.Login
+		}
+		result, err := m.limiter.Allow(r.Context(), key, g.Limit)
+		if err != nil {
+			logger.Warnf("error during rate limiting, request is allowed: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(g.Limit.Capacity()))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+		if !result.Allowed {
+			logger.Debugf("rate limit of group %s exceeded by %s", g.Name, key)
+			w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+			problem.Write(w, r, problem.TooManyRequests.WithDetail(
+				fmt.Sprintf("rate limit of %d requests per %s exceeded", g.Limit.Requests, g.Limit.Period)), m.logger)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
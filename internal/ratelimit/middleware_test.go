@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit/limiter"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestMiddleware(t *testing.T, clients ratelimit.ClientOptions) http.Handler {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	groups := []ratelimit.Group{{
+		Name:   "auth",
+		Limit:  ratelimit.Limit{Requests: 1, Period: time.Minute},
+		Routes: []string{"POST /sign-in"},
+	}}
+	m := ratelimit.NewMiddleware(limiter.NewInMemoryLimiter(logger), groups, clients,
+		func(path string) string { return path }, logger)
+	return m.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+type client struct {
+	remoteAddr string
+	forwarded  string
+	login      string
+}
+
+func (c client) request() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/sign-in", nil)
+	r.RemoteAddr = c.remoteAddr
+	if c.forwarded != "" {
+		r.Header.Set("X-Forwarded-For", c.forwarded)
+	}
+	if c.login != "" {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Login: c.login}))
+	}
+	return r
+}
+
+func TestMiddleware_Limit(t *testing.T) {
+	proxies, err := ratelimit.ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+	options := ratelimit.ClientOptions{TrustedProxies: proxies, ForwardedHeader: "X-Forwarded-For"}
+	tests := []struct {
+		name    string
+		first   client
+		second  client
+		limited bool
+	}{
+		{name: "same ip", first: client{remoteAddr: "192.0.2.1:1000"}, second: client{remoteAddr: "192.0.2.1:2000"},
+			limited: true},
+		{name: "another ip", first: client{remoteAddr: "192.0.2.1:1000"}, second: client{remoteAddr: "192.0.2.2:1000"}},
+		{name: "same login from other ips", first: client{remoteAddr: "192.0.2.1:1000", login: "alice"},
+			second: client{remoteAddr: "192.0.2.2:1000", login: "alice"}, limited: true},
+		{name: "other logins from same ip", first: client{remoteAddr: "192.0.2.1:1000", login: "alice"},
+			second: client{remoteAddr: "192.0.2.1:1000", login: "bob"}},
+		{name: "login is not limited by ip", first: client{remoteAddr: "192.0.2.1:1000"},
+			second: client{remoteAddr: "192.0.2.1:1000", login: "alice"}},
+		{name: "clients behind trusted proxy", first: client{remoteAddr: "10.0.0.1:1000", forwarded: "192.0.2.1"},
+			second: client{remoteAddr: "10.0.0.1:1000", forwarded: "192.0.2.2"}},
+		{name: "client behind chain of trusted proxies",
+			first:   client{remoteAddr: "10.0.0.1:1000", forwarded: "192.0.2.1, 192.168.1.1"},
+			second:  client{remoteAddr: "192.0.2.1:1000"},
+			limited: true},
+		{name: "address spoofed by client is ignored",
+			first:   client{remoteAddr: "10.0.0.1:1000", forwarded: "198.51.100.1, 192.0.2.1"},
+			second:  client{remoteAddr: "10.0.0.1:1000", forwarded: "198.51.100.2, 192.0.2.1"},
+			limited: true},
+		{name: "header of untrusted peer is ignored", first: client{remoteAddr: "192.0.2.1:1000", forwarded: "198.51.100.1"},
+			second: client{remoteAddr: "192.0.2.1:1000", forwarded: "198.51.100.2"}, limited: true},
+		{name: "unix socket peers behind proxy", first: client{remoteAddr: "@", forwarded: "192.0.2.1"},
+			second: client{remoteAddr: "@", forwarded: "192.0.2.2"}},
+		{name: "unix socket peers without forwarded address", first: client{remoteAddr: "@"},
+			second: client{remoteAddr: ""}, limited: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestMiddleware(t, options)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.first.request())
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("first request status = %d, want 204", w.Code)
+			}
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, tt.second.request())
+			if tt.limited {
+				if w.Code != http.StatusTooManyRequests {
+					t.Errorf("second request status = %d, want 429", w.Code)
+				}
+				if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+					t.Errorf("retry after = %q, want 60", retryAfter)
+				}
+			} else {
+				if w.Code != http.StatusNoContent {
+					t.Errorf("second request status = %d, want 204", w.Code)
+				}
+				if retryAfter := w.Header().Get("Retry-After"); retryAfter != "" {
+					t.Errorf("retry after = %q, want none", retryAfter)
+				}
+			}
+			if limit := w.Header().Get("RateLimit-Limit"); limit != "1" {
+				t.Errorf("rate limit = %q, want 1", limit)
+			}
+		})
+	}
+}
+
+func TestMiddleware_UnlimitedRoute(t *testing.T) {
+	h := newTestMiddleware(t, ratelimit.ClientOptions{})
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/notes", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d status = %d, want 204", i+1, w.Code)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, value := range []string{"10.0.0.300", "10.0.0.0/33", "proxy"} {
+		if _, err := ratelimit.ParseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("%q is accepted", value)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled with Requests tokens per Period and
+// holding at most Burst tokens, every request takes one token.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Validate rejects limits which would never refill the bucket or divide by
+// zero when computing Rate.
+func (l Limit) Validate() error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("requests must be positive, got %d", l.Requests)
+	}
+	if l.Period <= 0 {
+		return fmt.Errorf("period must be positive, got %s", l.Period)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst must not be negative, got %d", l.Burst)
+	}
+	return nil
+}
+
+// Capacity is the size of the bucket, it is Requests when Burst is not set.
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// Rate is the number of tokens added to the bucket per second.
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result describes the bucket state after a request took a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed.
+	RetryAfter time.Duration
+}
+
+// NewResult builds result for the bucket having tokens left.
+func NewResult(allowed bool, tokens float64, limit Limit) Result {
+	rate := limit.Rate()
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Capacity()) - tokens) / rate),
+	}
+	if tokens < 1 {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+type Limiter interface {
+	// Allow takes a token from the bucket of key.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,165 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps handler of a route.
+type Middleware func(http.Handler) http.Handler
+
+type route struct {
+	method  string
+	re      *regexp.Regexp
+	handler http.Handler
+}
+
+// Router dispatches requests by method and path pattern. Patterns consist
+// of literal segments and parameters like {login} or {id:[0-9]+}, values of
+// parameters are available to handlers through Param.
+//
+// Requests to known paths with unsupported method are answered with
+// 405 and Allow header, OPTIONS requests get Allow header only and HEAD
+// requests are served by GET handlers.
+type Router struct {
+	routes      []route
+	middlewares []Middleware
+	logger      *logrus.Logger
+}
+
+func New(logger *logrus.Logger) *Router {
+	return &Router{logger: logger}
+}
+
+// Use adds middlewares applied to every matched route, after route
+// middlewares are applied.
+func (rt *Router) Use(middlewares ...Middleware) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+}
+
+// Handle registers handler for method and pattern, middlewares are applied
+// in the given order, so the first one is the outermost.
+func (rt *Router) Handle(method, pattern string, handler http.Handler, middlewares ...Middleware) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	rt.routes = append(rt.routes, route{
+		method:  method,
+		re:      compile(pattern),
+		handler: handler,
+	})
+}
+
+func (rt *Router) HandleFunc(method, pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	rt.Handle(method, pattern, handler, middlewares...)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var matched *route
+	var params map[string]string
+	allowed := map[string]bool{}
+	for i := range rt.routes {
+		rr := &rt.routes[i]
+		match := rr.re.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			continue
+		}
+		allowed[rr.method] = true
+		if matched != nil {
+			continue
+		}
+		if rr.method == r.Method || (r.Method == http.MethodHead && rr.method == http.MethodGet && !rt.has(http.MethodHead, r.URL.Path)) {
+			matched = rr
+			params = map[string]string{}
+			for j, name := range rr.re.SubexpNames() {
+				if name != "" {
+					params[name] = match[j]
+				}
+			}
+		}
+	}
+
+	if len(allowed) == 0 {
+		problem.Write(w, r, problem.NotFound.WithDetail(fmt.Sprintf("no handler for %s %s", r.Method, r.URL.Path)), rt.logger)
+		return
+	}
+	if matched == nil {
+		w.Header().Set("Allow", allow(allowed))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		problem.Write(w, r, problem.MethodNotAllowed.WithDetail(fmt.Sprintf("method %s is not allowed for %s", r.Method, r.URL.Path)), rt.logger)
+		return
+	}
+
+	handler := matched.handler
+	for i := len(rt.middlewares) - 1; i >= 0; i-- {
+		handler = rt.middlewares[i](handler)
+	}
+	if r.Method == http.MethodHead && matched.method == http.MethodGet {
+		w = &headWriter{w}
+	}
+	handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, params)))
+}
+
+func (rt *Router) has(method, path string) bool {
+	for _, rr := range rt.routes {
+		if rr.method == method && rr.re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+type paramsKey struct{}
+
+// Param returns value of path parameter of the route matched for r.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func compile(pattern string) *regexp.Regexp {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			segments[i] = regexp.QuoteMeta(segment)
+			continue
+		}
+		name, expr, found := strings.Cut(segment[1:len(segment)-1], ":")
+		if !found {
+			expr = `[^/]+`
+		}
+		segments[i] = fmt.Sprintf("(?P<%s>%s)", name, expr)
+	}
+	return regexp.MustCompile("^" + strings.Join(segments, "/") + "$")
+}
+
+func allow(methods map[string]bool) string {
+	if methods[http.MethodGet] {
+		methods[http.MethodHead] = true
+	}
+	methods[http.MethodOptions] = true
+	var list []string
+	for m := range methods {
+		list = append(list, m)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// headWriter drops body of GET handler serving HEAD request.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (hw *headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRouter() *Router {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	rt := New(logger)
+	rt.HandleFunc(http.MethodGet, "/users/{login}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "user %s", Param(r, "login"))
+	})
+	rt.HandleFunc(http.MethodDelete, "/users/{login}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rt.HandleFunc(http.MethodGet, "/notes/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "note %s", Param(r, "id"))
+	})
+	rt.HandleFunc(http.MethodPost, "/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	rt.HandleFunc(http.MethodGet, "/users/{login}/notes/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "note %s of %s", Param(r, "id"), Param(r, "login"))
+	})
+	return rt
+}
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string
+		allow  string
+	}{
+		{name: "param", method: http.MethodGet, path: "/users/alice", status: http.StatusOK, body: "user alice"},
+		{name: "several params", method: http.MethodGet, path: "/users/alice/notes/7", status: http.StatusOK,
+			body: "note 7 of alice"},
+		{name: "constrained param", method: http.MethodGet, path: "/notes/42", status: http.StatusOK, body: "note 42"},
+		{name: "constraint not met", method: http.MethodGet, path: "/notes/abc", status: http.StatusNotFound},
+		{name: "param does not span segments", method: http.MethodGet, path: "/users/alice/bob",
+			status: http.StatusNotFound},
+		{name: "unknown path", method: http.MethodGet, path: "/unknown", status: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPut, path: "/users/alice", status: http.StatusMethodNotAllowed,
+			allow: "DELETE, GET, HEAD, OPTIONS"},
+		{name: "method not allowed without get", method: http.MethodGet, path: "/notes",
+			status: http.StatusMethodNotAllowed, allow: "OPTIONS, POST"},
+		{name: "options", method: http.MethodOptions, path: "/users/alice", status: http.StatusNoContent,
+			allow: "DELETE, GET, HEAD, OPTIONS"},
+		{name: "head served by get", method: http.MethodHead, path: "/users/alice", status: http.StatusOK},
+		{name: "head without get", method: http.MethodHead, path: "/notes", status: http.StatusMethodNotAllowed,
+			allow: "OPTIONS, POST"},
+	}
+	rt := newTestRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("allow = %q, want %q", allow, tt.allow)
+			}
+			if tt.method == http.MethodHead && tt.status == http.StatusOK && w.Body.Len() != 0 {
+				t.Errorf("body of head response = %q, want none", w.Body.String())
+			}
+			if w.Code >= 400 && !strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+json") {
+				t.Errorf("content type = %q, want problem", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRouter_MiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	rt := New(logger)
+	rt.Use(record("global 1"), record("global 2"))
+	rt.HandleFunc(http.MethodGet, "/users/{login}", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler "+Param(r, "login"))
+	}, record("route 1"), record("route 2"))
+	rt.HandleFunc(http.MethodGet, "/notes", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "notes")
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		calls  []string
+	}{
+		{name: "global before route", method: http.MethodGet, path: "/users/alice",
+			calls: []string{"global 1", "global 2", "route 1", "route 2", "handler alice"}},
+		{name: "global only", method: http.MethodGet, path: "/notes", calls: []string{"global 1", "global 2", "notes"}},
+		{name: "not applied to unmatched", method: http.MethodPost, path: "/notes", calls: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %v, want %v", calls, tt.calls)
+			}
+		})
+	}
+}
@@ -8,12 +8,46 @@ import (
 )
 
 type Config struct {
-	LogLevel string `yaml:"log_level"`
-	Listen   struct {
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+	Listen    struct {
 		Type   string `yaml:"type"`
 		BindIP string `yaml:"bind_ip"`
 		Port   string `yaml:"port"`
+		Unix   struct {
+			SocketPath string `yaml:"socket_path"`
+			SocketMode string `yaml:"socket_mode"`
+		} `yaml:"unix"`
+		Systemd struct {
+			Name         string `yaml:"name"`
+			ProbeAddress string `yaml:"probe_address"`
+		} `yaml:"systemd"`
+		TLS struct {
+			Enabled        bool     `yaml:"enabled"`
+			CertFile       string   `yaml:"cert_file"`
+			KeyFile        string   `yaml:"key_file"`
+			ReloadInterval string   `yaml:"reload_interval"`
+			MinVersion     string   `yaml:"min_version"`
+			CipherSuites   []string `yaml:"cipher_suites"`
+			ClientCAFile   string   `yaml:"client_ca_file"`
+			ClientAuth     string   `yaml:"client_auth"`
+			ClientLogins   struct {
+				Subjects      map[string]string `yaml:"subjects"`
+				UseCommonName bool              `yaml:"use_common_name"`
+			} `yaml:"client_logins"`
+		} `yaml:"tls"`
 	} `yaml:"listen"`
+	Http struct {
+		ReadHeaderTimeout string           `yaml:"read_header_timeout"`
+		ReadTimeout       string           `yaml:"read_timeout"`
+		WriteTimeout      string           `yaml:"write_timeout"`
+		IdleTimeout       string           `yaml:"idle_timeout"`
+		MaxHeaderBytes    int              `yaml:"max_header_bytes"`
+		RequestTimeout    string           `yaml:"request_timeout"`
+		MaxBodyBytes      int64            `yaml:"max_body_bytes"`
+		BodyLimits        map[string]int64 `yaml:"body_limits"`
+		Formats           []string         `yaml:"formats"`
+	} `yaml:"http"`
 	Storage struct {
 		Type    string `yaml:"type"`
 		Configs struct {
@@ -21,13 +55,129 @@ type Config struct {
 				Url  string `yaml:"url"`
 				Port string `yaml:"port"`
 				Db   struct {
-					NoteDb string `yaml:"note_db"`
-					UserDb string `yaml:"user_db"`
+					NoteDb      string `yaml:"note_db"`
+					UserDb      string `yaml:"user_db"`
+					RateLimitDb string `yaml:"rate_limit_db"`
 				} `yaml:"db"`
 				Password string `yaml:"password"`
+				Timeout  string `yaml:"timeout"`
 			} `yaml:"redis"`
 		} `yaml:"configs"`
 	} `yaml:"storage"`
+	Users struct {
+		Verification struct {
+			Enabled        bool   `yaml:"enabled"`
+			LinkBaseUrl    string `yaml:"link_base_url"`
+			TokenTTL       string `yaml:"token_ttl"`
+			ResendInterval string `yaml:"resend_interval"`
+		} `yaml:"verification"`
+		Deletion struct {
+			GracePeriod   string `yaml:"grace_period"`
+			PurgeInterval string `yaml:"purge_interval"`
+		} `yaml:"deletion"`
+		Rename struct {
+			ReservationPeriod string `yaml:"reservation_period"`
+		} `yaml:"rename"`
+		Authentication struct {
+			Backends []string `yaml:"backends"`
+			Ldap     struct {
+				Name                 string            `yaml:"name"`
+				Url                  string            `yaml:"url"`
+				StartTLS             bool              `yaml:"start_tls"`
+				InsecureSkipVerify   bool              `yaml:"insecure_skip_verify"`
+				Timeout              string            `yaml:"timeout"`
+				BindDn               string            `yaml:"bind_dn"`
+				BindPassword         string            `yaml:"bind_password"`
+				BaseDn               string            `yaml:"base_dn"`
+				UserFilter           string            `yaml:"user_filter"`
+				LoginAttribute       string            `yaml:"login_attribute"`
+				EmailAttribute       string            `yaml:"email_attribute"`
+				DisplayNameAttribute string            `yaml:"display_name_attribute"`
+				GroupAttribute       string            `yaml:"group_attribute"`
+				GroupBaseDn          string            `yaml:"group_base_dn"`
+				GroupFilter          string            `yaml:"group_filter"`
+				Roles                map[string]string `yaml:"roles"`
+			} `yaml:"ldap"`
+		} `yaml:"authentication"`
+	} `yaml:"users"`
+	Notes struct {
+		MaxLength int `yaml:"max_length"`
+	} `yaml:"notes"`
+	Export struct {
+		Dir     string `yaml:"dir"`
+		LinkTTL string `yaml:"link_ttl"`
+	} `yaml:"export"`
+	Oidc struct {
+		Providers []struct {
+			Name         string   `yaml:"name"`
+			Issuer       string   `yaml:"issuer"`
+			ClientId     string   `yaml:"client_id"`
+			ClientSecret string   `yaml:"client_secret"`
+			RedirectUrl  string   `yaml:"redirect_url"`
+			Scopes       []string `yaml:"scopes"`
+		} `yaml:"providers"`
+	} `yaml:"oidc"`
+	Health struct {
+		CacheTTL      string `yaml:"cache_ttl"`
+		Timeout       string `yaml:"timeout"`
+		MinFreeDiskMb uint64 `yaml:"min_free_disk_mb"`
+	} `yaml:"health"`
+	Tracing struct {
+		Exporter    string  `yaml:"exporter"`
+		ServiceName string  `yaml:"service_name"`
+		SampleRatio float64 `yaml:"sample_ratio"`
+		Otlp        struct {
+			Endpoint string            `yaml:"endpoint"`
+			Insecure bool              `yaml:"insecure"`
+			Headers  map[string]string `yaml:"headers"`
+		} `yaml:"otlp"`
+	} `yaml:"tracing"`
+	Cors struct {
+		Enabled          bool     `yaml:"enabled"`
+		AllowedOrigins   []string `yaml:"allowed_origins"`
+		AllowedMethods   []string `yaml:"allowed_methods"`
+		AllowedHeaders   []string `yaml:"allowed_headers"`
+		ExposedHeaders   []string `yaml:"exposed_headers"`
+		AllowCredentials bool     `yaml:"allow_credentials"`
+		MaxAge           string   `yaml:"max_age"`
+	} `yaml:"cors"`
+	Compression struct {
+		Enabled   bool     `yaml:"enabled"`
+		MinSize   int      `yaml:"min_size"`
+		Encodings []string `yaml:"encodings"`
+	} `yaml:"compression"`
+	RateLimit struct {
+		Enabled         bool     `yaml:"enabled"`
+		Backend         string   `yaml:"backend"`
+		TrustedProxies  []string `yaml:"trusted_proxies"`
+		ForwardedHeader string   `yaml:"forwarded_header"`
+		Groups          []struct {
+			Name     string   `yaml:"name"`
+			Requests int      `yaml:"requests"`
+			Period   string   `yaml:"period"`
+			Burst    int      `yaml:"burst"`
+			Routes   []string `yaml:"routes"`
+		} `yaml:"groups"`
+	} `yaml:"rate_limit"`
+	OpenApi struct {
+		SpecPath          string `yaml:"spec_path"`
+		ValidateRequests  bool   `yaml:"validate_requests"`
+		ValidateResponses bool   `yaml:"validate_responses"`
+	} `yaml:"openapi"`
+	Shutdown struct {
+		ReadinessDelay string `yaml:"readiness_delay"`
+		DrainTimeout   string `yaml:"drain_timeout"`
+	} `yaml:"shutdown"`
+	Mail struct {
+		Type string `yaml:"type"`
+		From string `yaml:"from"`
+		Smtp struct {
+			Host     string `yaml:"host"`
+			Port     string `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		} `yaml:"smtp"`
+	} `yaml:"mail"`
 }
 
 var instance *Config
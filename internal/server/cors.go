@@ -0,0 +1,127 @@
+package server
+
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cors lets browser clients of allowed origins call the API. Origins may
+// contain wildcards, e.g. "https://*.example.com", "*" allows any origin.
+type cors struct {
+	origins          []*regexp.Regexp
+	anyOrigin        bool
+	methods          string
+	headers          string
+	anyHeader        bool
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+	logger           *logrus.Logger
+}
+
+// newCors returns nil when cors is disabled.
+func newCors(config *Config, logger *logrus.Logger) *cors {
+	cfg := config.Cors
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &cors{
+		methods:          strings.Join(cfg.AllowedMethods, ", "),
+		exposedHeaders:   strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+		logger:           logger,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+			continue
+		}
+		expr := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[^/]*`)
+		c.origins = append(c.origins, regexp.MustCompile("^"+expr+"$"))
+	}
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+		}
+	}
+	c.headers = strings.Join(cfg.AllowedHeaders, ", ")
+	if maxAge := parseDuration(cfg.MaxAge, 0, logger); maxAge > 0 {
+		c.maxAge = strconv.Itoa(int(maxAge / time.Second))
+	}
+	return c
+}
+
+func (c *cors) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, re := range c.origins {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware answers preflight requests and adds cors headers to responses
+// for allowed origins. Nil cors passes all requests.
+func (c *cors) Middleware(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !c.allowed(origin) {
+			logging.FromContext(r.Context(), c.logger).Debugf("origin %s is not allowed", origin)
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.anyOrigin && !c.allowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.allowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if c.exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", c.exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		if c.anyHeader {
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		} else if c.headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		}
+		if c.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
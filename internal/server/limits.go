@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// limits caps size of request bodies and time of handling requests. Body
+// limits are looked up by "METHOD /route/{template}", requests to other
+// routes are limited by the default size.
+type limits struct {
+	maxBodyBytes int64
+	bodyLimits   map[string]int64
+	timeout      time.Duration
+	logger       *logrus.Logger
+}
+
+func newLimits(config *Config, logger *logrus.Logger) *limits {
+	return &limits{
+		maxBodyBytes: config.Http.MaxBodyBytes,
+		bodyLimits:   config.Http.BodyLimits,
+		timeout:      parseDuration(config.Http.RequestTimeout, 0, logger),
+		logger:       logger,
+	}
+}
+
+func (l *limits) bodyLimit(r *http.Request) int64 {
+	if limit, ok := l.bodyLimits[r.Method+" "+routes.Route(r.URL.Path)]; ok {
+		return limit
+	}
+	return l.maxBodyBytes
+}
+
+// Middleware rejects requests with bodies larger than their limit and sets
+// deadline of request context, so that outgoing calls of slow requests are
+// cancelled. Redis commands are bounded by timeouts of storage clients.
+func (l *limits) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := l.bodyLimit(r); limit > 0 {
+			if r.ContentLength > limit {
+				logging.FromContext(r.Context(), l.logger).Debugf("body of %d bytes exceeds limit", r.ContentLength)
+				problem.Write(w, r, problem.PayloadTooLarge.WithDetail(
+					fmt.Sprintf("request body must be at most %d bytes", limit)), l.logger)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		if l.timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), l.timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/Frank-Way/note-go-rest-service/internal/compression"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimits_DecompressedBody(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	const limit = 1 << 20
+	l := &limits{maxBodyBytes: limit, logger: logger}
+	m, err := compression.NewMiddleware(compression.Options{Encodings: []string{compression.Gzip}}, logger)
+	if err != nil {
+		t.Fatalf("new compression middleware: %v", err)
+	}
+	// composed as by Server.handle
+	h := m.Compress(l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			problem.Write(w, r, problem.MalformedBody(err), logger)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	tests := []struct {
+		name    string
+		size    int
+		gzipped bool
+		status  int
+	}{
+		{name: "plain body within limit", size: limit, status: http.StatusNoContent},
+		{name: "plain body over limit", size: limit + 1, status: http.StatusRequestEntityTooLarge},
+		{name: "gzip body within limit", size: limit, gzipped: true, status: http.StatusNoContent},
+		{name: "gzip bomb", size: 64 * limit, gzipped: true, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.size)
+			if tt.gzipped {
+				var buf bytes.Buffer
+				zw := gzip.NewWriter(&buf)
+				zw.Write(body)
+				zw.Close()
+				if buf.Len() > limit {
+					t.Fatalf("compressed body of %d bytes exceeds limit", buf.Len())
+				}
+				body = buf.Bytes()
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/notes", bytes.NewReader(body))
+			if tt.gzipped {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
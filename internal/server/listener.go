@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	listenTypePort    = "port"
+	listenTypeUnix    = "unix"
+	listenTypeSystemd = "systemd"
+
+	// systemd passes inherited sockets starting from this descriptor
+	systemdFdsStart = 3
+
+	defaultSocketMode = os.FileMode(0660)
+)
+
+func newListener(config *Config, logger *logrus.Logger) (net.Listener, error) {
+	switch config.Listen.Type {
+	case "", listenTypePort:
+		addr := net.JoinHostPort(config.Listen.BindIP, config.Listen.Port)
+		logger.Info("listen on address: " + addr)
+		return net.Listen("tcp", addr)
+	case listenTypeUnix:
+		return newUnixListener(config, logger)
+	case listenTypeSystemd:
+		return newSystemdListener(config, logger)
+	default:
+		return nil, fmt.Errorf("unknown listen type: %s", config.Listen.Type)
+	}
+}
+
+func newUnixListener(config *Config, logger *logrus.Logger) (net.Listener, error) {
+	path := config.Listen.Unix.SocketPath
+	if path == "" {
+		return nil, fmt.Errorf("socket path is not specified")
+	}
+	mode := defaultSocketMode
+	if config.Listen.Unix.SocketMode != "" {
+		m, err := strconv.ParseUint(config.Listen.Unix.SocketMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("wrong socket mode %q: %w", config.Listen.Unix.SocketMode, err)
+		}
+		mode = os.FileMode(m)
+	}
+	if err := removeStaleSocket(path, logger); err != nil {
+		return nil, err
+	}
+	logger.Info("listen on unix socket: " + path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes socket left by the process which was not shut
+// down properly. Socket somebody still listens on is not touched.
+func removeStaleSocket(path string, logger *logrus.Logger) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("error during checking socket %s: %w", path, err)
+	}
+	logger.Infof("remove stale socket %s", path)
+	return os.Remove(path)
+}
+
+// newSystemdListener takes listener passed by systemd socket activation,
+// see sd_listen_fds(3).
+func newSystemdListener(config *Config, logger *logrus.Logger) (net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	name := config.Listen.Systemd.Name
+	for i := 0; i < count; i++ {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+		fd := systemdFdsStart + i
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error during taking socket %d from systemd: %w", fd, err)
+		}
+		logger.Infof("listen on socket passed by systemd: %s", ln.Addr())
+		return ln, nil
+	}
+	return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+}
+
+// NewProbeClient returns client and base url to reach the server through
+// the listener configured in config.
+func NewProbeClient(config *Config, timeout time.Duration) (*http.Client, string, error) {
+	network, address := "tcp", ""
+	switch config.Listen.Type {
+	case "", listenTypePort:
+		host := config.Listen.BindIP
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+		}
+		address = net.JoinHostPort(host, config.Listen.Port)
+	case listenTypeUnix:
+		network, address = "unix", config.Listen.Unix.SocketPath
+	case listenTypeSystemd:
+		parts := strings.SplitN(config.Listen.Systemd.ProbeAddress, ":", 2)
+		if len(parts) != 2 || (parts[0] != "tcp" && parts[0] != "unix") {
+			return nil, "", fmt.Errorf("probe address should be tcp:host:port or unix:path, got %q",
+				config.Listen.Systemd.ProbeAddress)
+		}
+		network, address = parts[0], parts[1]
+	default:
+		return nil, "", fmt.Errorf("unknown listen type: %s", config.Listen.Type)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+	scheme := "http"
+	if config.Listen.TLS.Enabled {
+		scheme = "https"
+		// probe checks that local listener is alive, not its identity
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	host := address
+	if network == "unix" {
+		host = "localhost"
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, scheme + "://" + host, nil
+}
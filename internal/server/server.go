@@ -1,35 +1,103 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	authStorage "github.com/Frank-Way/note-go-rest-service/internal/auth/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec/format"
+	"github.com/Frank-Way/note-go-rest-service/internal/compression"
+	"github.com/Frank-Way/note-go-rest-service/internal/export"
+	exportStorage "github.com/Frank-Way/note-go-rest-service/internal/export/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/health"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail/mailer"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
 	"github.com/Frank-Way/note-go-rest-service/internal/note"
-	"github.com/Frank-Way/note-go-rest-service/internal/note/nerror"
 	noteStorage "github.com/Frank-Way/note-go-rest-service/internal/note/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/oidc"
+	"github.com/Frank-Way/note-go-rest-service/internal/openapi"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit"
+	"github.com/Frank-Way/note-go-rest-service/internal/ratelimit/limiter"
+	"github.com/Frank-Way/note-go-rest-service/internal/router"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
 	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/Frank-Way/note-go-rest-service/internal/user/authenticator"
 	userStorage "github.com/Frank-Way/note-go-rest-service/internal/user/storage"
-	"github.com/Frank-Way/note-go-rest-service/internal/user/uerror"
 	"github.com/sirupsen/logrus"
 	"io"
-	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
-	config   *Config
-	logger   *logrus.Logger
-	router   *http.ServeMux
-	uHandler *user.Handler
-	nHandler *note.Handler
+	config        *Config
+	logger        *logrus.Logger
+	router        *http.ServeMux
+	uService      user.Service
+	eService      export.Service
+	uHandler      *user.Handler
+	nHandler      *note.Handler
+	eHandler      *export.Handler
+	oHandler      *oidc.Handler
+	aHandler      *auth.OAuthHandler
+	hHandler      *health.Handler
+	authMw        *auth.Middleware
+	rateLimit     *ratelimit.Middleware
+	cors          *cors
+	limits        *limits
+	compression   *compression.Middleware
+	spec          *openapi.Spec
+	validator     *openapi.Validator
+	purgeInterval time.Duration
+	// storages are closed in this order on shutdown
+	storages []namedCloser
+	ready    atomic.Bool
+	// stopTracing flushes spans which are not exported yet
+	stopTracing func(context.Context) error
+}
+
+type namedCloser struct {
+	name string
+	io.Closer
 }
 
 func NewServer(config *Config) *Server {
 	var logger = logrus.New()
+	stopTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    config.Tracing.Exporter,
+		ServiceName: config.Tracing.ServiceName,
+		SampleRatio: config.Tracing.SampleRatio,
+		Otlp: tracing.OtlpOptions{
+			Endpoint: config.Tracing.Otlp.Endpoint,
+			Insecure: config.Tracing.Otlp.Insecure,
+			Headers:  config.Tracing.Otlp.Headers,
+		},
+	}, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// redis commands are bounded by socket timeouts, since go-redis ignores
+	// deadlines of contexts
+	redisTimeout := parseDuration(config.Storage.Configs.Redis.Timeout,
+		parseDuration(config.Http.RequestTimeout, 0, logger), logger)
 	var uStorage user.Storage
 	var nStorage note.Storage
+	var cStorage auth.ClientStorage
+	var sStorage auth.SessionStorage
 	if config.Storage.Type == "in_memory" {
 		uStorage = userStorage.NewInMemoryStorage(logger)
 		nStorage = noteStorage.NewInMemoryStorage(logger)
+		cStorage = authStorage.NewInMemoryStorage(logger)
+		sStorage = authStorage.NewInMemorySessionStorage(logger)
 	} else if config.Storage.Type == "redis" {
 		uDb, err := strconv.Atoi(config.Storage.Configs.Redis.Db.UserDb)
 		if err != nil {
@@ -40,6 +108,27 @@ func NewServer(config *Config) *Server {
 			config.Storage.Configs.Redis.Port,
 			config.Storage.Configs.Redis.Password,
 			uDb,
+			redisTimeout,
+			logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cStorage, err = authStorage.NewRedisStorage(
+			config.Storage.Configs.Redis.Url,
+			config.Storage.Configs.Redis.Port,
+			config.Storage.Configs.Redis.Password,
+			uDb,
+			redisTimeout,
+			logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		sStorage, err = authStorage.NewRedisSessionStorage(
+			config.Storage.Configs.Redis.Url,
+			config.Storage.Configs.Redis.Port,
+			config.Storage.Configs.Redis.Password,
+			uDb,
+			redisTimeout,
 			logger)
 		if err != nil {
 			logger.Fatal(err)
@@ -53,6 +142,7 @@ func NewServer(config *Config) *Server {
 			config.Storage.Configs.Redis.Port,
 			config.Storage.Configs.Redis.Password,
 			nDb,
+			redisTimeout,
 			logger)
 		if err != nil {
 			logger.Fatal(err)
@@ -60,30 +150,386 @@ func NewServer(config *Config) *Server {
 	} else {
 		logger.Fatal("unknown storage type specified in config")
 	}
-	var authService = auth.NewAuthService(logger)
-	var uService = user.NewService(authService, uStorage, logger)
-	var nService = note.NewService(authService, nStorage, logger)
-	return &Server{
-		config:   config,
-		logger:   logger,
-		router:   http.NewServeMux(),
-		uHandler: user.NewHandler(uService, logger),
-		nHandler: note.NewHandler(nService, logger),
+	uStorage = userStorage.NewInstrumentedStorage(uStorage, config.Storage.Type)
+	nStorage = noteStorage.NewInstrumentedStorage(nStorage, config.Storage.Type)
+	cStorage = authStorage.NewInstrumentedStorage(cStorage, config.Storage.Type)
+	sStorage = authStorage.NewInstrumentedSessionStorage(sStorage, config.Storage.Type)
+	var m mail.Mailer
+	if config.Mail.Type == "" || config.Mail.Type == "log" {
+		m = mailer.NewLogMailer(logger)
+	} else if config.Mail.Type == "smtp" {
+		m = mailer.NewSmtpMailer(
+			config.Mail.Smtp.Host,
+			config.Mail.Smtp.Port,
+			config.Mail.Smtp.Username,
+			config.Mail.Smtp.Password,
+			config.Mail.From,
+			logger)
+	} else {
+		logger.Fatal("unknown mail type specified in config")
+	}
+	var uOptions = user.Options{
+		Verification: user.VerificationOptions{
+			Enabled:        config.Users.Verification.Enabled,
+			LinkBaseUrl:    config.Users.Verification.LinkBaseUrl,
+			TokenTTL:       parseDuration(config.Users.Verification.TokenTTL, 24*time.Hour, logger),
+			ResendInterval: parseDuration(config.Users.Verification.ResendInterval, 5*time.Minute, logger),
+		},
+		Deletion: user.DeletionOptions{
+			GracePeriod: parseDuration(config.Users.Deletion.GracePeriod, 30*24*time.Hour, logger),
+		},
+		Rename: user.RenameOptions{
+			ReservationPeriod: parseDuration(config.Users.Rename.ReservationPeriod, 0, logger),
+		},
+	}
+	var authenticators []user.Authenticator
+	var backends = config.Users.Authentication.Backends
+	if len(backends) == 0 {
+		backends = []string{"store"}
+	}
+	for _, backend := range backends {
+		if backend == "store" {
+			authenticators = append(authenticators, authenticator.NewStoreAuthenticator(uStorage, logger))
+		} else if backend == "ldap" {
+			ldapConfig := config.Users.Authentication.Ldap
+			authenticators = append(authenticators, authenticator.NewLdapAuthenticator(authenticator.LdapConfig{
+				Name:                 ldapConfig.Name,
+				Url:                  ldapConfig.Url,
+				StartTLS:             ldapConfig.StartTLS,
+				InsecureSkipVerify:   ldapConfig.InsecureSkipVerify,
+				Timeout:              parseDuration(ldapConfig.Timeout, 0, logger),
+				BindDn:               ldapConfig.BindDn,
+				BindPassword:         ldapConfig.BindPassword,
+				BaseDn:               ldapConfig.BaseDn,
+				UserFilter:           ldapConfig.UserFilter,
+				LoginAttribute:       ldapConfig.LoginAttribute,
+				EmailAttribute:       ldapConfig.EmailAttribute,
+				DisplayNameAttribute: ldapConfig.DisplayNameAttribute,
+				GroupAttribute:       ldapConfig.GroupAttribute,
+				GroupBaseDn:          ldapConfig.GroupBaseDn,
+				GroupFilter:          ldapConfig.GroupFilter,
+				Roles:                ldapConfig.Roles,
+			}, logger))
+		} else {
+			logger.Fatalf("unknown authentication backend specified in config: %s", backend)
+		}
+	}
+	var authService = auth.NewAuthService(sStorage, logger)
+	var eOptions = export.Options{
+		Dir:     config.Export.Dir,
+		LinkTTL: parseDuration(config.Export.LinkTTL, 24*time.Hour, logger),
+	}
+	if eOptions.Dir == "" {
+		eOptions.Dir = filepath.Join(os.TempDir(), "note-go-rest-service-exports")
+	}
+	var eStorage = exportStorage.NewInstrumentedStorage(exportStorage.NewInMemoryStorage(logger), "in_memory")
+	eService, err := export.NewService(eStorage, uStorage, nStorage, authService, eOptions, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	var uService = user.NewTracingService(user.NewService(authService, uStorage,
+		authenticator.NewChainAuthenticator(authenticators, logger), nStorage, eService, m, uOptions, logger))
+	var nService = note.NewTracingService(note.NewService(nStorage, note.Options{MaxLength: config.Notes.MaxLength}, logger))
+	var aService = auth.NewOAuthService(authService, cStorage, uService, logger)
+	var oProviders []oidc.ProviderConfig
+	for _, p := range config.Oidc.Providers {
+		oProviders = append(oProviders, oidc.ProviderConfig{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientId:     p.ClientId,
+			ClientSecret: p.ClientSecret,
+			RedirectUrl:  p.RedirectUrl,
+			Scopes:       p.Scopes,
+		})
+	}
+	var oService = oidc.NewService(oProviders, uService, logger)
+	var checker = health.NewChecker(
+		parseDuration(config.Health.CacheTTL, 2*time.Second, logger),
+		parseDuration(config.Health.Timeout, time.Second, logger))
+	checker.Add("user_storage", uStorage.Ping)
+	checker.Add("note_storage", nStorage.Ping)
+	checker.Add("session_storage", sStorage.Ping)
+	checker.Add("oauth_client_storage", cStorage.Ping)
+	checker.Add("export_storage", eStorage.Ping)
+	checker.Add("auth_key", authService.CheckKey)
+	checker.Add("export_disk_space", health.DiskSpaceCheck(eOptions.Dir, config.Health.MinFreeDiskMb<<20))
+	codecs, err := newCodecs(config.Http.Formats, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	spec, err := openapi.LoadSpec(config.OpenApi.SpecPath, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	var validator *openapi.Validator
+	if config.OpenApi.ValidateRequests {
+		validator, err = openapi.NewValidator(openapi.Options{
+			Spec:              spec,
+			ValidateResponses: config.OpenApi.ValidateResponses,
+			Codecs:            codecs.Codecs(),
+		}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var rateLimit *ratelimit.Middleware
+	var rLimiter ratelimit.Limiter
+	if config.RateLimit.Enabled {
+		if config.RateLimit.Backend == "" || config.RateLimit.Backend == "in_memory" {
+			rLimiter = limiter.NewInMemoryLimiter(logger)
+		} else if config.RateLimit.Backend == "redis" {
+			rDb, err := strconv.Atoi(config.Storage.Configs.Redis.Db.RateLimitDb)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			rLimiter, err = limiter.NewRedisLimiter(
+				config.Storage.Configs.Redis.Url,
+				config.Storage.Configs.Redis.Port,
+				config.Storage.Configs.Redis.Password,
+				rDb,
+				redisTimeout,
+				logger)
+			if err != nil {
+				logger.Fatal(err)
+			}
+		} else {
+			logger.Fatal("unknown rate limit backend specified in config")
+		}
+		var groups []ratelimit.Group
+		for _, g := range config.RateLimit.Groups {
+			limit := ratelimit.Limit{
+				Requests: g.Requests,
+				Period:   parseDuration(g.Period, time.Minute, logger),
+				Burst:    g.Burst,
+			}
+			if err := limit.Validate(); err != nil {
+				logger.Fatalf("invalid limit of rate limit group %q: %v", g.Name, err)
+			}
+			groups = append(groups, ratelimit.Group{
+				Name:   g.Name,
+				Limit:  limit,
+				Routes: g.Routes,
+			})
+		}
+		proxies, err := ratelimit.ParseTrustedProxies(config.RateLimit.TrustedProxies)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		rateLimit = ratelimit.NewMiddleware(rLimiter, groups, ratelimit.ClientOptions{
+			TrustedProxies:  proxies,
+			ForwardedHeader: config.RateLimit.ForwardedHeader,
+		}, routes.Route, logger)
+		checker.Add("rate_limiter", rLimiter.Ping)
+	}
+	var compressionMw *compression.Middleware
+	if config.Compression.Enabled {
+		compressionMw, err = compression.NewMiddleware(compression.Options{
+			MinSize:   config.Compression.MinSize,
+			Encodings: config.Compression.Encodings,
+		}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var s = &Server{
+		config:        config,
+		logger:        logger,
+		router:        http.NewServeMux(),
+		uService:      uService,
+		eService:      eService,
+		uHandler:      user.NewHandler(uService, codecs, logger),
+		nHandler:      note.NewHandler(nService, codecs, logger),
+		eHandler:      export.NewHandler(eService, logger),
+		oHandler:      oidc.NewHandler(oService, logger),
+		aHandler:      auth.NewOAuthHandler(aService, logger),
+		spec:          spec,
+		validator:     validator,
+		authMw:        auth.NewMiddleware(authService, uService, logger),
+		rateLimit:     rateLimit,
+		cors:          newCors(config, logger),
+		limits:        newLimits(config, logger),
+		compression:   compressionMw,
+		purgeInterval: parseDuration(config.Users.Deletion.PurgeInterval, time.Hour, logger),
+		stopTracing:   stopTracing,
+		storages: []namedCloser{
+			{"export storage", eStorage},
+			{"note storage", nStorage},
+			{"oauth client storage", cStorage},
+			{"session storage", sStorage},
+			{"user storage", uStorage},
+		},
 	}
+	if rLimiter != nil {
+		s.storages = append(s.storages, namedCloser{"rate limiter", rLimiter})
+	}
+	s.hHandler = health.NewHandler(checker, s.ready.Load, logger)
+	return s
 }
 
-func (s *Server) Start() error {
+func newCodecs(formats []string, logger *logrus.Logger) (*codec.Codecs, error) {
+	if len(formats) == 0 {
+		formats = []string{"json"}
+	}
+	var codecs []codec.Codec
+	for _, f := range formats {
+		switch f {
+		case "json":
+			codecs = append(codecs, format.NewJsonCodec())
+		case "msgpack":
+			codecs = append(codecs, format.NewMsgpackCodec())
+		case "cbor":
+			c, err := format.NewCborCodec()
+			if err != nil {
+				return nil, err
+			}
+			codecs = append(codecs, c)
+		case "yaml":
+			codecs = append(codecs, format.NewYamlCodec())
+		default:
+			return nil, fmt.Errorf("unknown format %s", f)
+		}
+	}
+	return codec.New(logger, codecs...), nil
+}
+
+func parseDuration(value string, defaultValue time.Duration, logger *logrus.Logger) time.Duration {
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return d
+}
+
+// Start serves requests until ctx is done, then drains in-flight requests
+// and releases resources.
+func (s *Server) Start(ctx context.Context) error {
 	if err := s.configureLogger(); err != nil {
 		return err
 	}
 
-	var addr = net.JoinHostPort(s.config.Listen.BindIP, s.config.Listen.Port)
-
-	s.logger.Info("starting user server on address: " + addr)
+	s.logger.Info("starting user server")
 
 	s.configureRouter()
 
-	return http.ListenAndServe(addr, s.router)
+	var handler http.Handler = s.router
+	var tlsConfig *tls.Config
+	if s.config.Listen.TLS.Enabled {
+		s.logger.Debug("configuring tls")
+		var err error
+		if tlsConfig, err = newTLSConfig(s.config, s.logger); err != nil {
+			return err
+		}
+		if tlsConfig.ClientCAs != nil {
+			logins := s.config.Listen.TLS.ClientLogins
+			handler = auth.NewCertificateMapper(logins.Subjects, logins.UseCommonName, s.logger).Middleware(handler)
+		}
+	}
+
+	ln, err := newListener(s.config, s.logger)
+	if err != nil {
+		return err
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		s.runPurger(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		s.eService.Run(workersCtx)
+	}()
+
+	srv := &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: parseDuration(s.config.Http.ReadHeaderTimeout, 5*time.Second, s.logger),
+		ReadTimeout:       parseDuration(s.config.Http.ReadTimeout, 0, s.logger),
+		WriteTimeout:      parseDuration(s.config.Http.WriteTimeout, 0, s.logger),
+		IdleTimeout:       parseDuration(s.config.Http.IdleTimeout, 0, s.logger),
+		MaxHeaderBytes:    s.config.Http.MaxHeaderBytes,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- srv.ServeTLS(ln, "", "")
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err = <-serveErr:
+		s.logger.Errorf("server stopped: %v", err)
+	case <-ctx.Done():
+		s.logger.Info("shutting down server")
+		err = s.shutdown(srv)
+	}
+	stopWorkers()
+	workers.Wait()
+	s.closeStorages()
+	s.flushTraces()
+	return err
+}
+
+// shutdown reports the server as not ready, so that load balancer stops
+// sending new requests, and then waits for in-flight requests.
+func (s *Server) shutdown(srv *http.Server) error {
+	s.ready.Store(false)
+	readinessDelay := parseDuration(s.config.Shutdown.ReadinessDelay, 0, s.logger)
+	if readinessDelay > 0 {
+		s.logger.Infof("wait %s before closing listener", readinessDelay)
+		time.Sleep(readinessDelay)
+	}
+	drainTimeout := parseDuration(s.config.Shutdown.DrainTimeout, 30*time.Second, s.logger)
+	s.logger.Infof("drain in-flight requests for at most %s", drainTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		s.logger.Warnf("error during draining requests, close remaining connections: %v", err)
+		return srv.Close()
+	}
+	s.logger.Info("all requests are drained")
+	return nil
+}
+
+func (s *Server) closeStorages() {
+	for _, storage := range s.storages {
+		s.logger.Debugf("close %s", storage.name)
+		if err := storage.Close(); err != nil {
+			s.logger.Errorf("error during closing %s: %v", storage.name, err)
+		}
+	}
+}
+
+func (s *Server) flushTraces() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.stopTracing(ctx); err != nil {
+		s.logger.Errorf("error during flushing traces: %v", err)
+	}
+}
+
+func (s *Server) runPurger(ctx context.Context) {
+	s.logger.Debugf("purging deactivated users every %s", s.purgeInterval)
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.uService.PurgeDeactivated(ctx); err != nil {
+				s.logger.Errorf("error during purging deactivated users: %v", err)
+			}
+		}
+	}
 }
 
 func (s *Server) configureLogger() error {
@@ -94,22 +540,76 @@ func (s *Server) configureLogger() error {
 
 	s.logger.SetLevel(level)
 
+	formatter, err := logging.NewFormatter(s.config.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	s.logger.SetFormatter(formatter)
+
 	s.logger.Debug("log level set to " + level.String())
 
 	return nil
 }
 
+// routes are templates of served paths used to label metrics and spans
+var routes = metrics.NewRouteMatcher(
+	"/api/v1/users",
+	"/api/v1/users/{login}",
+	"/api/v1/users/{login}/verify",
+	"/api/v1/users/{login}/rename",
+	"/api/v1/users/{login}/sessions",
+	"/api/v1/users/{login}/sessions/{id}",
+	"/api/v1/users/{login}/export",
+	"/api/v1/users/{login}/export/{id}",
+	"/api/v1/users/{login}/export/{id}/download",
+	"/api/v1/oidc/{provider}/login",
+	"/api/v1/oidc/{provider}/callback",
+	"/api/v1/oauth/clients",
+	"/api/v1/oauth/authorize",
+	"/api/v1/oauth/token",
+	"/api/v1/oauth/introspect",
+	"/api/v1/oauth/revoke",
+	"/api/v1/notes",
+	"/api/v1/notes/{id}",
+	"/livez",
+	"/readyz",
+	"/metrics",
+	"/openapi.json",
+	"/docs",
+	"/docs/{asset}",
+)
+
 func (s *Server) configureRouter() {
 	s.logger.Debug("configuring router")
 
-	uMiddleware := uerror.Middleware(s.uHandler.Handler)
-	nMiddleware := nerror.Middleware(s.nHandler.Handler)
+	api := router.New(s.logger)
+	api.Use(s.authMw.Authenticate, s.rateLimit.Limit, s.validator.Middleware)
+	s.uHandler.Register(api)
+	s.eHandler.Register(api)
+	s.oHandler.Register(api)
+	s.nHandler.Register(api)
+	s.handle("/api/", api)
 
-	s.router.Handle("/api/v1/users/", uMiddleware)
-	s.router.Handle("/api/v1/users", uMiddleware)
+	// oauth endpoints report errors in RFC 6749 format, so they are not
+	// validated against the spec
+	s.handle("/api/v1/oauth/", s.authMw.Authenticate(s.rateLimit.Limit(s.aHandler.Middleware())))
 
-	s.router.Handle("/api/v1/notes/", nMiddleware)
-	s.router.Handle("/api/v1/notes", nMiddleware)
+	s.handle("/livez", http.HandlerFunc(s.hHandler.Livez))
+	s.handle("/readyz", http.HandlerFunc(s.hHandler.Readyz))
+	s.handle("/metrics", metrics.Handler())
+	s.handle("/openapi.json", http.HandlerFunc(s.spec.Handler))
+	s.handle("/docs", http.HandlerFunc(openapi.DocsHandler))
+	s.handle("/docs/", http.HandlerFunc(openapi.DocsHandler))
+}
 
-	s.router.HandleFunc("/health", func(rw http.ResponseWriter, r *http.Request) { io.WriteString(rw, "I'm healthy") })
+func (s *Server) handle(pattern string, handler http.Handler) {
+	handler = s.limits.Middleware(handler)
+	handler = s.cors.Middleware(handler)
+	// decompressed request bodies are limited by s.limits, responses are
+	// measured by metrics as sent
+	handler = s.compression.Compress(handler)
+	handler = metrics.Middleware(routes, handler)
+	handler = logging.Middleware(s.logger, routes.Route, handler)
+	s.router.Handle(pattern, tracing.Middleware(routes.Route, handler))
 }
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCertCheckInterval = time.Minute
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.NoClientCert,
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// certReloader serves certificate from files and reloads it when the files
+// are changed, so that rotated certificate is picked up without restart.
+type certReloader struct {
+	sync.Mutex
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	logger        *logrus.Logger
+
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, checkInterval time.Duration, logger *logrus.Logger) (*certReloader, error) {
+	cr := &certReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: checkInterval,
+		logger:        logger,
+	}
+	modTime, err := cr.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err = cr.load(modTime); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if now := time.Now(); now.Sub(cr.checkedAt) >= cr.checkInterval {
+		cr.checkedAt = now
+		modTime, err := cr.lastModified()
+		if err != nil {
+			cr.logger.Warnf("error during checking certificate files, keep serving loaded certificate: %v", err)
+		} else if !modTime.Equal(cr.modTime) {
+			cr.logger.Info("certificate files changed, reload certificate")
+			if err = cr.load(modTime); err != nil {
+				cr.logger.Warnf("error during reloading certificate, keep serving loaded certificate: %v", err)
+			}
+		}
+	}
+	return cr.cert, nil
+}
+
+func (cr *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.checkedAt = time.Now()
+	return nil
+}
+
+func (cr *certReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, path := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func newTLSConfig(config *Config, logger *logrus.Logger) (*tls.Config, error) {
+	tlsConfig := config.Listen.TLS
+	reloader, err := newCertReloader(tlsConfig.CertFile, tlsConfig.KeyFile,
+		parseDuration(tlsConfig.ReloadInterval, defaultCertCheckInterval, logger), logger)
+	if err != nil {
+		return nil, fmt.Errorf("error during loading certificate: %w", err)
+	}
+	result := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if tlsConfig.MinVersion != "" {
+		version, ok := tlsVersions[tlsConfig.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version: %s", tlsConfig.MinVersion)
+		}
+		result.MinVersion = version
+	}
+	if len(tlsConfig.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range tlsConfig.CipherSuites {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite: %s", name)
+			}
+			result.CipherSuites = append(result.CipherSuites, id)
+		}
+	}
+	clientAuth, ok := clientAuthTypes[tlsConfig.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unknown client auth type: %s", tlsConfig.ClientAuth)
+	}
+	result.ClientAuth = clientAuth
+	if tlsConfig.ClientCAFile != "" {
+		pem, err := os.ReadFile(tlsConfig.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error during reading client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle: %s", tlsConfig.ClientCAFile)
+		}
+		result.ClientCAs = pool
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client CA bundle is required to verify client certificates")
+	}
+	return result, nil
+}
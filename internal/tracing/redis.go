@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// Redis returns copy of client bound to ctx, which records span for every
+// command and pipeline it sends.
+func Redis(ctx context.Context, client *redis.Client) *redis.Client {
+	c := client.WithContext(ctx)
+	c.WrapProcess(func(process func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			_, span := Start(ctx, "redis "+cmd.Name(),
+				semconv.DBSystemRedis,
+				semconv.DBOperationKey.String(cmd.Name()))
+			err := process(cmd)
+			endRedis(span, err)
+			return err
+		}
+	})
+	c.WrapProcessPipeline(func(process func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			names := make([]string, 0, len(cmds))
+			for _, cmd := range cmds {
+				names = append(names, cmd.Name())
+			}
+			_, span := Start(ctx, "redis pipeline",
+				semconv.DBSystemRedis,
+				semconv.DBOperationKey.String(strings.Join(names, " ")))
+			err := process(cmds)
+			endRedis(span, err)
+			return err
+		}
+	})
+	return c
+}
+
+// endRedis ends span, missing key is a regular result and is not recorded
+// as error.
+func endRedis(span trace.Span, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	End(span, err)
+}
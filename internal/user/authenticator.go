@@ -0,0 +1,19 @@
+package user
+
+import "context"
+
+// Authenticator checks user's password against some credentials backend.
+// Authenticator that does not know the user returns problem.NotFound,
+// so the next one may be tried.
+type Authenticator interface {
+	Authenticate(ctx context.Context, login string, password string) (Identity, error)
+}
+
+// Identity is a result of successful authentication. Users authenticated
+// by external backend have External set and are linked to (or provisioned
+// as) local users the same way as users of external identity providers.
+type Identity struct {
+	Login    string
+	External *ExternalSignInDTO
+	Roles    []string
+}
@@ -0,0 +1,43 @@
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+var _ user.Authenticator = &chainAuthenticator{}
+
+// chainAuthenticator tries authenticators in order until one of them knows
+// the user. Wrong password reported by any of them is final.
+type chainAuthenticator struct {
+	authenticators []user.Authenticator
+	logger         *logrus.Logger
+}
+
+func NewChainAuthenticator(authenticators []user.Authenticator, logger *logrus.Logger) user.Authenticator {
+	return &chainAuthenticator{
+		authenticators: authenticators,
+		logger:         logger,
+	}
+}
+
+func (ca *chainAuthenticator) Authenticate(ctx context.Context, login string, password string) (user.Identity, error) {
+	logger := logging.FromContext(ctx, ca.logger)
+	err := error(problem.NotFound)
+	for i, a := range ca.authenticators {
+		logger.Debugf("try authenticator #%d", i)
+		var identity user.Identity
+		identity, err = a.Authenticate(ctx, login, password)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, problem.NotFound) {
+			return user.Identity{}, err
+		}
+	}
+	return user.Identity{}, err
+}
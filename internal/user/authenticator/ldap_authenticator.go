@@ -0,0 +1,294 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ user.Authenticator = &ldapAuthenticator{}
+
+const defaultLdapTimeout = 10 * time.Second
+
+type LdapConfig struct {
+	// Name is used as provider of external identities of LDAP users.
+	Name               string
+	Url                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// BindDn and BindPassword are credentials of service account used to
+	// search users and groups, anonymous search is used when BindDn is empty.
+	BindDn       string
+	BindPassword string
+	BaseDn       string
+	// UserFilter is a filter with single %s placeholder for login,
+	// e.g. (&(objectClass=person)(uid=%s)).
+	UserFilter           string
+	LoginAttribute       string
+	EmailAttribute       string
+	DisplayNameAttribute string
+	// GroupAttribute is an attribute of user entry listing DNs of user's
+	// groups, e.g. memberOf.
+	GroupAttribute string
+	// GroupBaseDn and GroupFilter are used to search groups when directory
+	// has no GroupAttribute, GroupFilter has single %s placeholder for
+	// user's DN, e.g. (member=%s).
+	GroupBaseDn string
+	GroupFilter string
+	// Roles maps group DNs to roles granted to members of the group.
+	Roles map[string]string
+}
+
+// LdapConn is the part of LDAP connection used by authenticator. It allows
+// to run authenticator against in-process directory stand-in.
+type LdapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+type LdapDialer func(ctx context.Context) (LdapConn, error)
+
+type ldapAuthenticator struct {
+	config LdapConfig
+	dial   LdapDialer
+	roles  map[string]string
+	logger *logrus.Logger
+}
+
+func NewLdapAuthenticator(config LdapConfig, logger *logrus.Logger) user.Authenticator {
+	return NewLdapAuthenticatorWithDialer(config, newLdapDialer(config), logger)
+}
+
+func NewLdapAuthenticatorWithDialer(config LdapConfig, dial LdapDialer, logger *logrus.Logger) user.Authenticator {
+	if config.Name == "" {
+		config.Name = "ldap"
+	}
+	if config.LoginAttribute == "" {
+		config.LoginAttribute = "uid"
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(" + config.LoginAttribute + "=%s)"
+	}
+	// DNs are compared case-insensitively
+	roles := make(map[string]string, len(config.Roles))
+	for group, role := range config.Roles {
+		roles[normalizeDn(group)] = role
+	}
+	return &ldapAuthenticator{
+		config: config,
+		dial:   dial,
+		roles:  roles,
+		logger: logger,
+	}
+}
+
+func newLdapDialer(config LdapConfig) LdapDialer {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultLdapTimeout
+	}
+	return func(ctx context.Context) (LdapConn, error) {
+		tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+		conn, err := ldap.DialURL(config.Url,
+			ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+			ldap.DialWithTLSConfig(tlsConfig))
+		if err != nil {
+			return nil, err
+		}
+		conn.SetTimeout(timeout)
+		if config.StartTLS {
+			if u, err := url.Parse(config.Url); err == nil {
+				tlsConfig.ServerName = u.Hostname()
+			}
+			if err = conn.StartTLS(tlsConfig); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+}
+
+func (la *ldapAuthenticator) Authenticate(ctx context.Context, login string, password string) (user.Identity, error) {
+	logger := logging.FromContext(ctx, la.logger)
+	logger.Info("authenticate user by ldap")
+	if password == "" {
+		// empty password means unauthenticated bind which always succeeds
+		logger.Debug("empty password provided")
+		return user.Identity{}, problem.WrongCredentials.WithDetail("wrong password provided")
+	}
+	logger.Debug("connect to directory")
+	conn, err := la.dial(ctx)
+	if err != nil {
+		logger.Debugf("error during connecting to directory: %v", err)
+		return user.Identity{}, ldapError(err)
+	}
+	defer conn.Close()
+	if err = la.bindServiceAccount(ctx, conn); err != nil {
+		return user.Identity{}, ldapError(err)
+	}
+	logger.Debug("search user entry")
+	entry, err := la.findUser(ctx, conn, login)
+	if err != nil {
+		return user.Identity{}, err
+	}
+	logger.Debugf("bind as %s", entry.DN)
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			logger.Debug("wrong password")
+			return user.Identity{}, problem.WrongCredentials.Wrap(err).WithDetail("wrong password provided")
+		}
+		logger.Debugf("error during binding as user: %v", err)
+		return user.Identity{}, ldapError(err)
+	}
+	logger.Debug("collect user's groups")
+	groups, err := la.findGroups(ctx, conn, entry)
+	if err != nil {
+		return user.Identity{}, ldapError(err)
+	}
+	ldapLogin := entry.GetAttributeValue(la.config.LoginAttribute)
+	if ldapLogin == "" {
+		ldapLogin = login
+	}
+	return user.Identity{
+		External: &user.ExternalSignInDTO{
+			Identity: user.ExternalIdentity{
+				Provider: la.config.Name,
+				Subject:  ldapLogin,
+			},
+			PreferredLogin: ldapLogin,
+			Email:          la.attribute(entry, la.config.EmailAttribute),
+			DisplayName:    la.attribute(entry, la.config.DisplayNameAttribute),
+		},
+		Roles: la.mapRoles(groups),
+	}, nil
+}
+
+func (la *ldapAuthenticator) bindServiceAccount(ctx context.Context, conn LdapConn) error {
+	logger := logging.FromContext(ctx, la.logger)
+	if la.config.BindDn == "" {
+		return nil
+	}
+	logger.Debug("bind as service account")
+	if err := conn.Bind(la.config.BindDn, la.config.BindPassword); err != nil {
+		logger.Debugf("error during binding as service account: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (la *ldapAuthenticator) findUser(ctx context.Context, conn LdapConn, login string) (*ldap.Entry, error) {
+	logger := logging.FromContext(ctx, la.logger)
+	attributes := []string{la.config.LoginAttribute}
+	for _, a := range []string{la.config.EmailAttribute, la.config.DisplayNameAttribute, la.config.GroupAttribute} {
+		if a != "" {
+			attributes = append(attributes, a)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		la.config.BaseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(la.config.UserFilter, ldap.EscapeFilter(login)),
+		attributes,
+		nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		logger.Debugf("error during searching user: %v", err)
+		return nil, ldapError(err)
+	}
+	if result == nil || len(result.Entries) == 0 {
+		logger.Debug("user not found in directory")
+		return nil, problem.NotFound
+	}
+	if len(result.Entries) > 1 {
+		logger.Warnf("login %q matches several directory entries, check user filter", login)
+		return nil, problem.WrongCredentials.WithDetail("ambiguous login")
+	}
+	return result.Entries[0], nil
+}
+
+func (la *ldapAuthenticator) findGroups(ctx context.Context, conn LdapConn, entry *ldap.Entry) ([]string, error) {
+	logger := logging.FromContext(ctx, la.logger)
+	var groups []string
+	if la.config.GroupAttribute != "" {
+		groups = append(groups, entry.GetAttributeValues(la.config.GroupAttribute)...)
+	}
+	if la.config.GroupFilter == "" {
+		return groups, nil
+	}
+	// user may be not allowed to search groups, so search them as service
+	// account again
+	if err := la.bindServiceAccount(ctx, conn); err != nil {
+		return nil, err
+	}
+	baseDn := la.config.GroupBaseDn
+	if baseDn == "" {
+		baseDn = la.config.BaseDn
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(la.config.GroupFilter, ldap.EscapeFilter(entry.DN)),
+		[]string{"dn"},
+		nil))
+	if err != nil {
+		logger.Debugf("error during searching groups: %v", err)
+		return nil, err
+	}
+	for _, g := range result.Entries {
+		groups = append(groups, g.DN)
+	}
+	return groups, nil
+}
+
+func (la *ldapAuthenticator) mapRoles(groups []string) []string {
+	set := make(map[string]bool)
+	for _, g := range groups {
+		if role, ok := la.roles[normalizeDn(g)]; ok {
+			set[role] = true
+		}
+	}
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func (la *ldapAuthenticator) attribute(entry *ldap.Entry, name string) string {
+	if name == "" {
+		return ""
+	}
+	return entry.GetAttributeValue(name)
+}
+
+func normalizeDn(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		parts := make([]string, 0, len(parsed.RDNs))
+		for _, rdn := range parsed.RDNs {
+			attributes := make([]string, 0, len(rdn.Attributes))
+			for _, a := range rdn.Attributes {
+				attributes = append(attributes, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+			}
+			parts = append(parts, strings.Join(attributes, "+"))
+		}
+		return strings.Join(parts, ",")
+	}
+	return strings.ToLower(strings.TrimSpace(dn))
+}
+
+func ldapError(err error) error {
+	return problem.Storage.Wrap(err).WithDetail("directory is unavailable")
+}
@@ -0,0 +1,335 @@
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/sirupsen/logrus"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const (
+	testBindDn       = "cn=service,dc=example,dc=org"
+	testBindPassword = "service-secret"
+	testAliceDn      = "uid=alice,ou=people,dc=example,dc=org"
+	testAdminsDn     = "cn=admins,ou=groups,dc=example,dc=org"
+	testWritersDn    = "cn=writers,ou=groups,dc=example,dc=org"
+)
+
+// fakeDirectory is an in-process stand-in of LDAP server. Search results are
+// looked up by exact filter, so tests also check filters built by
+// authenticator.
+type fakeDirectory struct {
+	passwords map[string]string
+	results   map[string][]*ldap.Entry
+	dialErr   error
+	dials     int
+	searches  []*ldap.SearchRequest
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		passwords: map[string]string{
+			testBindDn:  testBindPassword,
+			testAliceDn: "alice-secret",
+		},
+		results: map[string][]*ldap.Entry{
+			"(uid=alice)": {ldap.NewEntry(testAliceDn, map[string][]string{
+				"uid":      {"alice"},
+				"mail":     {"alice@example.org"},
+				"cn":       {"Alice"},
+				"memberOf": {"CN=Admins,OU=Groups,DC=example,DC=org"},
+			})},
+			"(member=" + testAliceDn + ")": {ldap.NewEntry(testWritersDn, nil)},
+		},
+	}
+}
+
+func (fd *fakeDirectory) dial(ctx context.Context) (LdapConn, error) {
+	fd.dials++
+	if fd.dialErr != nil {
+		return nil, fd.dialErr
+	}
+	return &fakeConn{directory: fd}, nil
+}
+
+type fakeConn struct {
+	directory *fakeDirectory
+	boundDn   string
+}
+
+func (fc *fakeConn) Bind(username, password string) error {
+	if expected, ok := fc.directory.passwords[username]; !ok || expected != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	fc.boundDn = username
+	return nil
+}
+
+func (fc *fakeConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if fc.boundDn != testBindDn {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("search is not allowed"))
+	}
+	fc.directory.searches = append(fc.directory.searches, request)
+	entries := fc.directory.results[request.Filter]
+	if request.SizeLimit > 0 && len(entries) > request.SizeLimit {
+		return &ldap.SearchResult{Entries: entries[:request.SizeLimit]},
+			ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+	}
+	return &ldap.SearchResult{Entries: entries}, nil
+}
+
+func (fc *fakeConn) Close() {}
+
+func newTestLdapConfig() LdapConfig {
+	return LdapConfig{
+		BindDn:               testBindDn,
+		BindPassword:         testBindPassword,
+		BaseDn:               "dc=example,dc=org",
+		EmailAttribute:       "mail",
+		DisplayNameAttribute: "cn",
+		Roles: map[string]string{
+			testAdminsDn:  "admin",
+			testWritersDn: "writer",
+		},
+	}
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestLdapAuthenticator_Authenticate(t *testing.T) {
+	fd := newFakeDirectory()
+	a := NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger())
+
+	identity, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := user.Identity{
+		External: &user.ExternalSignInDTO{
+			Identity:       user.ExternalIdentity{Provider: "ldap", Subject: "alice"},
+			PreferredLogin: "alice",
+			Email:          "alice@example.org",
+			DisplayName:    "Alice",
+		},
+		Roles: []string{},
+	}
+	if !reflect.DeepEqual(identity, expected) {
+		t.Errorf("identity = %+v, want %+v", identity, expected)
+	}
+}
+
+func TestLdapAuthenticator_WrongPassword(t *testing.T) {
+	fd := newFakeDirectory()
+	a := NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger())
+
+	if _, err := a.Authenticate(context.Background(), "alice", "wrong"); !errors.Is(err, problem.WrongCredentials) {
+		t.Errorf("error = %v, want wrong credentials", err)
+	}
+}
+
+func TestLdapAuthenticator_EmptyPassword(t *testing.T) {
+	fd := newFakeDirectory()
+	// unauthenticated bind of the directory succeeds with any DN
+	fd.passwords[testAliceDn] = ""
+	a := NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger())
+
+	if _, err := a.Authenticate(context.Background(), "alice", ""); !errors.Is(err, problem.WrongCredentials) {
+		t.Errorf("error = %v, want wrong credentials", err)
+	}
+	if fd.dials != 0 {
+		t.Errorf("directory was dialed %d times, want no connection for empty password", fd.dials)
+	}
+}
+
+func TestLdapAuthenticator_DirectoryUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(fd *fakeDirectory, config *LdapConfig)
+	}{
+		{
+			name: "dial failure",
+			modify: func(fd *fakeDirectory, config *LdapConfig) {
+				fd.dialErr = errors.New("connection refused")
+			},
+		},
+		{
+			name: "service account bind failure",
+			modify: func(fd *fakeDirectory, config *LdapConfig) {
+				config.BindPassword = "wrong"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := newFakeDirectory()
+			config := newTestLdapConfig()
+			tt.modify(fd, &config)
+			a := NewLdapAuthenticatorWithDialer(config, fd.dial, newTestLogger())
+
+			if _, err := a.Authenticate(context.Background(), "alice", "alice-secret"); !errors.Is(err, problem.Storage) {
+				t.Errorf("error = %v, want storage problem", err)
+			}
+		})
+	}
+}
+
+func TestLdapAuthenticator_UserNotFound(t *testing.T) {
+	fd := newFakeDirectory()
+	a := NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger())
+
+	if _, err := a.Authenticate(context.Background(), "bob", "bob-secret"); !errors.Is(err, problem.NotFound) {
+		t.Errorf("error = %v, want not found", err)
+	}
+	// special characters of login must not change the filter
+	if _, err := a.Authenticate(context.Background(), "*", "secret"); !errors.Is(err, problem.NotFound) {
+		t.Errorf("error = %v, want not found", err)
+	}
+	if filter := fd.searches[len(fd.searches)-1].Filter; filter != `(uid=\2a)` {
+		t.Errorf("filter = %q, want escaped login", filter)
+	}
+}
+
+func TestLdapAuthenticator_AmbiguousLogin(t *testing.T) {
+	fd := newFakeDirectory()
+	fd.results["(uid=alice)"] = append(fd.results["(uid=alice)"],
+		ldap.NewEntry("uid=alice,ou=contractors,dc=example,dc=org", map[string][]string{"uid": {"alice"}}),
+		ldap.NewEntry("uid=alice,ou=archive,dc=example,dc=org", map[string][]string{"uid": {"alice"}}))
+	a := NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger())
+
+	_, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	if !errors.Is(err, problem.WrongCredentials) {
+		t.Errorf("error = %v, want wrong credentials", err)
+	}
+}
+
+func TestLdapAuthenticator_Roles(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *LdapConfig)
+		roles  []string
+	}{
+		{
+			name:  "no groups configured",
+			roles: []string{},
+		},
+		{
+			name: "group attribute",
+			modify: func(config *LdapConfig) {
+				config.GroupAttribute = "memberOf"
+			},
+			roles: []string{"admin"},
+		},
+		{
+			name: "group filter",
+			modify: func(config *LdapConfig) {
+				config.GroupBaseDn = "ou=groups,dc=example,dc=org"
+				config.GroupFilter = "(member=%s)"
+			},
+			roles: []string{"writer"},
+		},
+		{
+			name: "group attribute and group filter",
+			modify: func(config *LdapConfig) {
+				config.GroupAttribute = "memberOf"
+				config.GroupFilter = "(member=%s)"
+			},
+			roles: []string{"admin", "writer"},
+		},
+		{
+			name: "unmapped groups",
+			modify: func(config *LdapConfig) {
+				config.GroupAttribute = "memberOf"
+				config.GroupFilter = "(member=%s)"
+				config.Roles = map[string]string{"cn=readers,ou=groups,dc=example,dc=org": "reader"}
+			},
+			roles: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := newFakeDirectory()
+			config := newTestLdapConfig()
+			if tt.modify != nil {
+				tt.modify(&config)
+			}
+			a := NewLdapAuthenticatorWithDialer(config, fd.dial, newTestLogger())
+
+			identity, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(identity.Roles, tt.roles) {
+				t.Errorf("roles = %v, want %v", identity.Roles, tt.roles)
+			}
+			if config.GroupBaseDn != "" {
+				if baseDn := fd.searches[len(fd.searches)-1].BaseDN; baseDn != config.GroupBaseDn {
+					t.Errorf("groups searched in %q, want %q", baseDn, config.GroupBaseDn)
+				}
+			}
+		})
+	}
+}
+
+// stubAuthenticator authenticates single user with fixed password.
+type stubAuthenticator struct {
+	login    string
+	password string
+	calls    int
+}
+
+func (sa *stubAuthenticator) Authenticate(ctx context.Context, login string, password string) (user.Identity, error) {
+	sa.calls++
+	if login != sa.login {
+		return user.Identity{}, problem.NotFound
+	}
+	if password != sa.password {
+		return user.Identity{}, problem.WrongCredentials
+	}
+	return user.Identity{Login: login}, nil
+}
+
+func TestChainAuthenticator_Ldap(t *testing.T) {
+	fd := newFakeDirectory()
+	local := &stubAuthenticator{login: "bob", password: "bob-secret"}
+	a := NewChainAuthenticator([]user.Authenticator{
+		NewLdapAuthenticatorWithDialer(newTestLdapConfig(), fd.dial, newTestLogger()),
+		local,
+	}, newTestLogger())
+
+	identity, err := a.Authenticate(context.Background(), "bob", "bob-secret")
+	if err != nil {
+		t.Fatalf("user missing in directory: unexpected error: %v", err)
+	}
+	if identity.Login != "bob" {
+		t.Errorf("user missing in directory: login = %q, want bob", identity.Login)
+	}
+
+	identity, err = a.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("directory user: unexpected error: %v", err)
+	}
+	if identity.External == nil || identity.External.Identity.Provider != "ldap" {
+		t.Errorf("directory user: identity = %+v, want external ldap identity", identity)
+	}
+
+	calls := local.calls
+	if _, err = a.Authenticate(context.Background(), "alice", "wrong"); !errors.Is(err, problem.WrongCredentials) {
+		t.Errorf("wrong directory password: error = %v, want wrong credentials", err)
+	}
+	if local.calls != calls {
+		t.Error("wrong directory password must not fall through the chain")
+	}
+
+	if _, err = a.Authenticate(context.Background(), "carol", "secret"); !errors.Is(err, problem.NotFound) {
+		t.Errorf("unknown user: error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,47 @@
+package authenticator
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+var _ user.Authenticator = &storeAuthenticator{}
+
+// storeAuthenticator checks password against bcrypt hash kept in user
+// storage.
+type storeAuthenticator struct {
+	storage user.Storage
+	logger  *logrus.Logger
+}
+
+func NewStoreAuthenticator(storage user.Storage, logger *logrus.Logger) user.Authenticator {
+	return &storeAuthenticator{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+func (sa *storeAuthenticator) Authenticate(ctx context.Context, login string, password string) (user.Identity, error) {
+	logger := logging.FromContext(ctx, sa.logger)
+	logger.Info("authenticate user by user storage")
+	logger.Debug("check if user exists")
+	u, err := sa.storage.GetByLogin(ctx, login)
+	if err != nil {
+		logger.Debug("user not found")
+		return user.Identity{}, err
+	}
+	logger.Debug("check if user has local password")
+	if !u.HasPassword() {
+		logger.Debug("user has no local password")
+		return user.Identity{}, problem.NotFound
+	}
+	logger.Debug("check password")
+	if err = u.CheckPassword(password); err != nil {
+		logger.Debug("wrong password")
+		return user.Identity{}, problem.WrongCredentials.Wrap(err).WithDetail("wrong password provided")
+	}
+	return user.Identity{Login: u.Login, Roles: u.Roles}, nil
+}
@@ -1,9 +1,12 @@
 package user
 
+import "time"
+
 type CreateUserDTO struct {
 	Login          string `json:"login"`
 	Password       string `json:"password"`
 	RepeatPassword string `json:"repeat_password"`
+	Email          string `json:"email"`
 }
 
 type UpdateUserDTO struct {
@@ -19,3 +22,55 @@ type AuthUserDTO struct {
 	//Login    string `json:"login"`
 	Password string `json:"password"`
 }
+
+type TokenDTO struct {
+	Token string `json:"token"`
+}
+
+type ProfileDTO struct {
+	Login       string   `json:"login"`
+	Email       string   `json:"email"`
+	DisplayName string   `json:"display_name"`
+	AvatarUrl   string   `json:"avatar_url"`
+	Timezone    string   `json:"timezone"`
+	Locale      string   `json:"locale"`
+	IsPending   bool     `json:"is_pending"`
+	Roles       []string `json:"roles,omitempty"`
+	// PendingEmail is set until the new email is verified.
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
+// SessionDTO describes session of sign in or access token granted to
+// third-party client, the latter has ClientId.
+type SessionDTO struct {
+	Id         string    `json:"id"`
+	ClientId   string    `json:"client_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Ip         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// PatchUserDTO holds profile fields to change, nil fields are left as is.
+type PatchUserDTO struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	AvatarUrl   *string `json:"avatar_url"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+}
+
+type RenameUserDTO struct {
+	NewLogin string `json:"new_login"`
+	Password string `json:"password"`
+}
+
+// ExternalSignInDTO describes user authenticated by external identity
+// provider. PreferredLogin is used for just-in-time provisioning.
+type ExternalSignInDTO struct {
+	Identity       ExternalIdentity
+	PreferredLogin string
+	Email          string
+	DisplayName    string
+}
@@ -1,102 +1,91 @@
 package user
 
 import (
-	"encoding/json"
 	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/codec"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/router"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"regexp"
+	"strconv"
 )
 
 type Handler struct {
 	service Service
+	codecs  *codec.Codecs
 	logger  *logrus.Logger
 }
 
-func NewHandler(service Service, logger *logrus.Logger) *Handler {
+func NewHandler(service Service, codecs *codec.Codecs, logger *logrus.Logger) *Handler {
 	return &Handler{
 		service: service,
+		codecs:  codecs,
 		logger:  logger,
 	}
 }
 
-var (
-	noLoginRe = regexp.MustCompile(`^/api/v1/users$`)
-	loginRe   = regexp.MustCompile(`^/api/v1/users/([A-Za-z0-9_]+)$`)
-)
+const loginParam = `{login:[A-Za-z0-9_]+}`
 
-func (h *Handler) Handler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle user request")
-	w.Header().Set("content-type", "application/json")
-	switch {
-	case r.Method == http.MethodPost && noLoginRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to save handler")
-		return h.saveHandler(w, r)
-	case r.Method == http.MethodPut && loginRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to update handler")
-		return h.updateHandler(w, r)
-	case r.Method == http.MethodPost && loginRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to auth handler")
-		return h.authHandler(w, r)
-	case r.Method == http.MethodDelete && loginRe.MatchString(r.URL.Path):
-		h.logger.Debug("delegate to delete handler")
-		return h.deleteHandler(w, r)
-	// TODO DELETE DEBUG ENDPOINTS
-	//case r.Method == http.MethodGet && r.URL.Path == `/debug/allusers`:
-	//	u, err := h.service.TMPGetAllUsers(r.Context())
-	//	if err != nil {
-	//		return err
-	//	}
-	//	jsonBytes, err := json.Marshal(u)
-	//	if err != nil {
-	//		return err
-	//	}
-	//	w.WriteHeader(http.StatusOK)
-	//	w.Write(jsonBytes)
-	//	return nil
-	default:
-		h.logger.Debug("no handlers for request")
-		return fmt.Errorf("wrong method %s on path: %s", r.Method, r.URL.Path)
-	}
+// Register adds user routes to rt.
+func (h *Handler) Register(rt *router.Router) {
+	rt.Handle(http.MethodPost, "/api/v1/users", h.handle(h.saveHandler))
+	rt.Handle(http.MethodPut, "/api/v1/users/"+loginParam, h.handle(h.updateHandler))
+	rt.Handle(http.MethodPost, "/api/v1/users/"+loginParam, h.handle(h.authHandler))
+	rt.Handle(http.MethodGet, "/api/v1/users/"+loginParam, h.handle(h.getProfileHandler))
+	rt.Handle(http.MethodPatch, "/api/v1/users/"+loginParam, h.handle(h.updateProfileHandler))
+	rt.Handle(http.MethodDelete, "/api/v1/users/"+loginParam, h.handle(h.deleteHandler))
+	rt.Handle(http.MethodGet, "/api/v1/users/"+loginParam+"/verify", h.handle(h.verifyHandler))
+	rt.Handle(http.MethodPost, "/api/v1/users/"+loginParam+"/verify", h.handle(h.resendVerificationHandler))
+	rt.Handle(http.MethodPost, "/api/v1/users/"+loginParam+"/rename", h.handle(h.renameHandler))
+	rt.Handle(http.MethodGet, "/api/v1/users/"+loginParam+"/sessions", h.handle(h.listSessionsHandler))
+	rt.Handle(http.MethodDelete, "/api/v1/users/"+loginParam+"/sessions/{id:[A-Za-z0-9_-]+}", h.handle(h.revokeSessionHandler))
+}
+
+func (h *Handler) handle(handler func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return h.codecs.Middleware(problem.Middleware(handler, h.logger))
 }
 
 func (h *Handler) saveHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle save user request")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle save user request")
 	var uDTO CreateUserDTO
-	h.logger.Debug("decoding create user dto from json")
-	if err := json.NewDecoder(r.Body).Decode(&uDTO); err != nil {
-		h.logger.Debugf("error during decoding json: %v", err)
-		return err
+	logger.Debug("decoding create user dto")
+	if err := h.codecs.Decode(r, &uDTO); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
 	}
-	h.logger.Debug("pass dto to service")
+	logger.Debug("pass dto to service")
 	uri, err := h.service.SignUp(r.Context(), uDTO)
 	if err != nil {
-		h.logger.Debugf("error in service: %v", err)
+		logger.Debugf("error in service: %v", err)
 		return err
 	}
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Location", "/api/v1/users/"+uri)
+	w.WriteHeader(http.StatusCreated)
 	return nil
 }
 
 func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle update user request")
-	h.logger.Debug("getting login from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle update user request")
+	logger.Debug("getting login from request path")
 	login, err := getLoginFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting login: %v", err)
+		logger.Debugf("error during getting login: %v", err)
 		return err
 	}
-	h.logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
 	var uDTO UpdateUserDTO
-	h.logger.Debug("decoding update user dto from json")
-	if err := json.NewDecoder(r.Body).Decode(&uDTO); err != nil {
-		h.logger.Debugf("error during decoding json: %v", err)
-		return err
+	logger.Debug("decoding update user dto")
+	if err := h.codecs.Decode(r, &uDTO); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
 	}
-	h.logger.Debug("pass dto to service")
-	if err := h.service.ChangePassword(r.Context(), login, uDTO); err != nil {
-		h.logger.Debugf("error in service: %v", err)
+	logger.Debug("pass dto to service")
+	if err := h.service.ChangePassword(r.Context(), uDTO); err != nil {
+		logger.Debugf("error in service: %v", err)
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -104,18 +93,25 @@ func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (h *Handler) deleteHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle delete user request")
-	h.logger.Debug("getting login from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle delete user request")
+	logger.Debug("getting login from request path")
 	login, err := getLoginFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting login: %v", err)
+		logger.Debugf("error during getting login: %v", err)
 		return err
 	}
-	h.logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
-	authHeader := r.Header.Get("Authorization")
-	h.logger.Debug("pass login to service")
-	if err = h.service.DeleteUser(r.Context(), authHeader, login); err != nil {
-		h.logger.Debugf("error in service: %v", err)
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	purge := false
+	if purgeStr := r.URL.Query().Get("purge"); purgeStr != "" {
+		if purge, err = strconv.ParseBool(purgeStr); err != nil {
+			logger.Debugf("error during parsing purge flag: %v", err)
+			return problem.BadRequest.Wrap(err).WithDetail("purge must be boolean")
+		}
+	}
+	logger.Debug("pass login to service")
+	if err = h.service.DeleteUser(r.Context(), login, purge); err != nil {
+		logger.Debugf("error in service: %v", err)
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -123,35 +119,196 @@ func (h *Handler) deleteHandler(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (h *Handler) authHandler(w http.ResponseWriter, r *http.Request) error {
-	h.logger.Info("handle auth user request")
-	h.logger.Debug("getting login from request path")
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle auth user request")
+	logger.Debug("getting login from request path")
 	login, err := getLoginFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error during getting login: %v", err)
+		logger.Debugf("error during getting login: %v", err)
 		return err
 	}
-	h.logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
 	var uDTO AuthUserDTO
-	h.logger.Debug("decoding auth user dto from json")
-	if err := json.NewDecoder(r.Body).Decode(&uDTO); err != nil {
-		h.logger.Debugf("error during decoding json: %v", err)
+	logger.Debug("decoding auth user dto")
+	if err := h.codecs.Decode(r, &uDTO); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
+	}
+	logger.Debug("pass dto to service")
+	ctx := auth.WithClientInfo(r.Context(), auth.NewClientInfo(r))
+	token, err := h.service.SignIn(ctx, login, uDTO)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	logging.SetLogin(ctx, login)
+	if err := h.codecs.Write(w, r, http.StatusOK, TokenDTO{Token: token}); err != nil {
+		logger.Debugf("error during token marshaling: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) getProfileHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle get profile request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
+	if err != nil {
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Debug("pass login to service")
+	profile, err := h.service.GetProfile(r.Context(), login)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	if err := h.codecs.Write(w, r, http.StatusOK, profile); err != nil {
+		logger.Debugf("error during profile marshaling: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) updateProfileHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle update profile request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
+	if err != nil {
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	var pDTO PatchUserDTO
+	logger.Debug("decoding patch user dto")
+	if err := h.codecs.Decode(r, &pDTO); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
+	}
+	logger.Debug("pass dto to service")
+	profile, err := h.service.UpdateProfile(r.Context(), login, pDTO)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	if err := h.codecs.Write(w, r, http.StatusOK, profile); err != nil {
+		logger.Debugf("error during profile marshaling: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) renameHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle rename user request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
+	if err != nil {
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	var rDTO RenameUserDTO
+	logger.Debug("decoding rename user dto")
+	if err := h.codecs.Decode(r, &rDTO); err != nil {
+		logger.Debugf("error during decoding body: %v", err)
+		return problem.MalformedBody(err)
+	}
+	logger.Debug("pass dto to service")
+	newLogin, err := h.service.Rename(r.Context(), login, rDTO)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	w.Header().Set("Location", "/api/v1/users/"+newLogin)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) listSessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle list sessions request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
+	if err != nil {
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Debug("pass login to service")
+	sessions, err := h.service.ListSessions(r.Context(), login)
+	if err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	if err := h.codecs.Write(w, r, http.StatusOK, sessions); err != nil {
+		logger.Debugf("error during sessions marshaling: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) revokeSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle revoke session request")
+	logger.Debug("getting login and session id from request path")
+	login, id := router.Param(r, "login"), router.Param(r, "id")
+	logger.Tracef("got login '%s' and session id '%s' from path '%s'", login, id, r.URL.Path)
+	logger.Debug("pass session id to service")
+	if err := h.service.RevokeSession(r.Context(), login, id); err != nil {
+		logger.Debugf("error in service: %v", err)
 		return err
 	}
-	h.logger.Debug("pass dto to service")
-	token, err := h.service.SignIn(r.Context(), login, uDTO)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) verifyHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle verify user request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
 	if err != nil {
-		h.logger.Debugf("error in service: %v", err)
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	token := r.URL.Query().Get("token")
+	logger.Debug("pass token to service")
+	if err = h.service.VerifyEmail(r.Context(), login, token); err != nil {
+		logger.Debugf("error in service: %v", err)
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) resendVerificationHandler(w http.ResponseWriter, r *http.Request) error {
+	logger := logging.FromContext(r.Context(), h.logger)
+	logger.Info("handle resend verification request")
+	logger.Debug("getting login from request path")
+	login, err := getLoginFromUrl(r)
+	if err != nil {
+		logger.Debugf("error during getting login: %v", err)
+		return err
+	}
+	logger.Tracef("got login '%s' from path '%s'", login, r.URL.Path)
+	logger.Debug("pass login to service")
+	if err = h.service.ResendVerification(r.Context(), login); err != nil {
+		logger.Debugf("error in service: %v", err)
 		return err
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(token))
+	w.WriteHeader(http.StatusAccepted)
 	return nil
 }
 
 func getLoginFromUrl(r *http.Request) (string, error) {
-	matches := loginRe.FindStringSubmatch(r.URL.Path)
-	if len(matches) < 2 {
-		return "", fmt.Errorf("no login in url: %s", r.URL.Path)
+	login := router.Param(r, "login")
+	if login == "" {
+		return "", problem.NotFound.WithDetail(fmt.Sprintf("no login in url: %s", r.URL.Path))
 	}
-	return matches[1], nil
+	return login, nil
 }
@@ -1,16 +1,73 @@
 package user
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
 
 type User struct {
-	Id       int    `db:"id" json:"id"`
-	Login    string `db:"login" json:"login"`
-	Password string `db:"password" json:"password"`
-	IsActive bool   `db:"is_active" json:"is_active"`
+	Id          int    `db:"id" json:"id"`
+	Login       string `db:"login" json:"login"`
+	Password    string `db:"password" json:"-"`
+	Email       string `db:"email" json:"email"`
+	DisplayName string `db:"display_name" json:"display_name"`
+	AvatarUrl   string `db:"avatar_url" json:"avatar_url"`
+	Timezone    string `db:"timezone" json:"timezone"`
+	Locale      string `db:"locale" json:"locale"`
+	IsActive    bool   `db:"is_active" json:"is_active"`
+	IsPending   bool   `db:"is_pending" json:"is_pending"`
+	// VerificationSentAt is the time verification link was last sent, links
+	// are not re-sent more often than once per resend interval.
+	VerificationSentAt *time.Time `db:"verification_sent_at" json:"verification_sent_at,omitempty"`
+	// PendingEmail is the new email which is not verified yet, it replaces
+	// Email on verification.
+	PendingEmail string `db:"pending_email" json:"pending_email,omitempty"`
+	// DeactivatedAt is set when user deletes account and is used to
+	// compute the end of the grace period before the data is purged.
+	DeactivatedAt *time.Time `db:"deactivated_at" json:"deactivated_at,omitempty"`
+	// ExternalIdentities links user to accounts of external identity
+	// providers the user signs in with.
+	ExternalIdentities []ExternalIdentity `db:"external_identities" json:"external_identities,omitempty"`
+	// Roles are granted by authentication backend, e.g. mapped from
+	// directory groups.
+	Roles []string `db:"roles" json:"roles,omitempty"`
+}
+
+type ExternalIdentity struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
 }
 
 type Users = []User
 
+func equalRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CanBeReactivated reports whether deactivated user still may undo the
+// deletion by signing in.
+func (u *User) CanBeReactivated(now time.Time, gracePeriod time.Duration) bool {
+	return !u.IsActive && u.DeactivatedAt != nil && now.Before(u.DeactivatedAt.Add(gracePeriod))
+}
+
+// IsPurgeDue reports whether the grace period of deactivated user is over.
+func (u *User) IsPurgeDue(now time.Time, gracePeriod time.Duration) bool {
+	return !u.IsActive && u.DeactivatedAt != nil && !now.Before(u.DeactivatedAt.Add(gracePeriod))
+}
+
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
 func (u *User) CheckPassword(password string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil {
@@ -19,7 +76,12 @@ func (u *User) CheckPassword(password string) error {
 	return nil
 }
 
+// GeneratePasswordHash replaces password with its hash. Users provisioned
+// from external identities have no local password and keep it empty.
 func (u *User) GeneratePasswordHash() error {
+	if u.Password == "" {
+		return nil
+	}
 	pwd, err := generatePasswordHash(u.Password)
 	if err != nil {
 		return err
@@ -40,13 +102,74 @@ func NewUser(dto CreateUserDTO) User {
 	return User{
 		Login:    dto.Login,
 		Password: dto.Password,
+		Email:    dto.Email,
+	}
+}
+
+func UpdateUser(u User, dto UpdateUserDTO) User {
+	u.Password = dto.NewPassword
+	return u
+}
+
+func PatchUser(u User, dto PatchUserDTO) User {
+	if dto.DisplayName != nil {
+		u.DisplayName = *dto.DisplayName
+	}
+	if dto.Email != nil {
+		u.Email = *dto.Email
+	}
+	if dto.AvatarUrl != nil {
+		u.AvatarUrl = *dto.AvatarUrl
+	}
+	if dto.Timezone != nil {
+		u.Timezone = *dto.Timezone
+	}
+	if dto.Locale != nil {
+		u.Locale = *dto.Locale
+	}
+	return u
+}
+
+func NewProfile(u User) ProfileDTO {
+	return ProfileDTO{
+		Login:        u.Login,
+		Email:        u.Email,
+		DisplayName:  u.DisplayName,
+		AvatarUrl:    u.AvatarUrl,
+		Timezone:     u.Timezone,
+		Locale:       u.Locale,
+		IsPending:    u.IsPending,
+		Roles:        u.Roles,
+		PendingEmail: u.PendingEmail,
+	}
+}
+
+func NewSessionDTO(s auth.Session) SessionDTO {
+	return SessionDTO{
+		Id:         s.Id,
+		ClientId:   s.ClientId,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Ip:         s.Ip,
+		UserAgent:  s.UserAgent,
+	}
+}
+
+func (u *User) HasExternalIdentity(identity ExternalIdentity) bool {
+	for _, i := range u.ExternalIdentities {
+		if i == identity {
+			return true
+		}
 	}
+	return false
 }
 
-func UpdateUser(id int, login string, dto UpdateUserDTO) User {
+func NewExternalUser(login string, dto ExternalSignInDTO) User {
 	return User{
-		Id:       id,
-		Login:    login,
-		Password: dto.NewPassword,
+		Login:              login,
+		Email:              dto.Email,
+		DisplayName:        dto.DisplayName,
+		ExternalIdentities: []ExternalIdentity{dto.Identity},
 	}
 }
@@ -2,9 +2,19 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Frank-Way/note-go-rest-service/internal/auth"
-	"github.com/Frank-Way/note-go-rest-service/internal/user/uerror"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
 	"github.com/sirupsen/logrus"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var _ Service = &service{}
@@ -12,169 +22,819 @@ var _ Service = &service{}
 type Service interface {
 	SignUp(ctx context.Context, dto CreateUserDTO) (string, error)
 	SignIn(ctx context.Context, login string, dto AuthUserDTO) (string, error)
-	ChangePassword(ctx context.Context, authStr string, dto UpdateUserDTO) error
-	DeleteUser(ctx context.Context, authStr string, login string) error
+	SignInExternal(ctx context.Context, dto ExternalSignInDTO) (string, error)
+	CheckCredentials(ctx context.Context, login string, password string) (string, error)
+	GetPrincipal(ctx context.Context, login string) (auth.Principal, error)
+	ChangePassword(ctx context.Context, dto UpdateUserDTO) error
+	DeleteUser(ctx context.Context, login string, purge bool) error
+	PurgeDeactivated(ctx context.Context) (int, error)
+	Rename(ctx context.Context, login string, dto RenameUserDTO) (string, error)
+	ListSessions(ctx context.Context, login string) ([]SessionDTO, error)
+	RevokeSession(ctx context.Context, login string, id string) error
+	GetProfile(ctx context.Context, login string) (ProfileDTO, error)
+	UpdateProfile(ctx context.Context, login string, dto PatchUserDTO) (ProfileDTO, error)
+	VerifyEmail(ctx context.Context, login string, token string) error
+	ResendVerification(ctx context.Context, login string) error
+}
+
+type Options struct {
+	Verification VerificationOptions
+	Deletion     DeletionOptions
+	Rename       RenameOptions
+}
+
+// VerificationOptions configures e-mail verification of new accounts.
+// When Enabled is false users are active right after sign up. Links are
+// re-sent on request at most once per ResendInterval.
+type VerificationOptions struct {
+	Enabled        bool
+	LinkBaseUrl    string
+	TokenTTL       time.Duration
+	ResendInterval time.Duration
+}
+
+// DeletionOptions configures account deletion. Deleted user may restore
+// the account by signing in until GracePeriod is over, after that the user
+// and all of his notes are purged.
+type DeletionOptions struct {
+	GracePeriod time.Duration
+}
+
+// RenameOptions configures login renaming. Old login can not be taken by
+// anyone during ReservationPeriod, zero period disables the reservation.
+type RenameOptions struct {
+	ReservationPeriod time.Duration
 }
 
 type service struct {
-	authMw  *auth.Middleware
-	storage Storage
-	logger  *logrus.Logger
+	authMw        *auth.Middleware
+	storage       Storage
+	authenticator Authenticator
+	notes         NoteStorage
+	exports       Exports
+	mailer        mail.Mailer
+	options       Options
+	logger        *logrus.Logger
 }
 
-func NewService(authSrv auth.Service, storage Storage, logger *logrus.Logger) Service {
+// NewService returns user service, exports may be nil when users have no
+// export jobs to purge.
+func NewService(authSrv auth.Service, storage Storage, authenticator Authenticator, notes NoteStorage,
+	exports Exports, mailer mail.Mailer, options Options, logger *logrus.Logger) Service {
 	return &service{
-		authMw:  auth.NewMiddleware(authSrv, logger),
-		storage: storage,
-		logger:  logger,
+		authMw:        auth.NewMiddleware(authSrv, nil, logger),
+		storage:       storage,
+		authenticator: authenticator,
+		notes:         notes,
+		exports:       exports,
+		mailer:        mailer,
+		options:       options,
+		logger:        logger,
 	}
 }
 
 func (s service) SignUp(ctx context.Context, dto CreateUserDTO) (string, error) {
-	s.logger.Info("sign up user")
-	s.logger.Debug("check if passwords matching")
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("sign up user")
+	logger.Debug("check if passwords matching")
 	if match := dto.Password == dto.RepeatPassword; !match {
-		s.logger.Debug("passwords does not match")
-		err := uerror.ErrorPasswordsMismatch
-		return "", err
+		logger.Debug("passwords does not match")
+		return "", problem.PasswordsMismatch
+	}
+	logger.Debug("validate login")
+	if err := validateLogin(dto.Login); err != nil {
+		logger.Debugf("invalid login: %v", err)
+		return "", problem.Validation.WithDetail(err.Error())
 	}
-	s.logger.Debug("check if user exists")
+	logger.Debug("check if user exists")
 	u, err := s.storage.GetByLogin(ctx, dto.Login)
 	if err == nil {
-		s.logger.Debug("user found")
-		err := uerror.ErrorDuplicate
-		err.Message = "user already exists"
+		logger.Debug("user found")
+		return "", problem.Conflict.WithDetail("user already exists")
+	}
+	if s.options.Verification.Enabled {
+		logger.Debug("check if email is valid")
+		if err := validateEmail(dto.Email); err != nil {
+			logger.Debugf("invalid email: %v", err)
+			return "", problem.Validation.WithDetail("valid email is required")
+		}
+	}
+	logger.Debug("check if login is reserved")
+	if err := s.checkLoginIsFree(ctx, dto.Login); err != nil {
 		return "", err
 	}
-	s.logger.Debug("create user from dto")
+	logger.Debug("create user from dto")
 	u = NewUser(dto)
 	u.IsActive = true
-	s.logger.Debug("pass user to storage to save it")
+	u.IsPending = s.options.Verification.Enabled
+	if u.IsPending {
+		now := time.Now()
+		u.VerificationSentAt = &now
+	}
+	logger.Debug("pass user to storage to save it")
 	uri, err := s.storage.Save(ctx, u)
 	if err != nil {
-		s.logger.Debugf("error during saving user to storage: %v", err)
+		logger.Debugf("error during saving user to storage: %v", err)
 		return "", err
 	}
-	s.logger.Debug("user saved")
+	logger.Debug("user saved")
+	if u.IsPending {
+		logger.Debug("send verification link")
+		if err := s.sendVerification(ctx, u, u.Email); err != nil {
+			logger.Warnf("error during sending verification link, it can be re-sent later: %v", err)
+		}
+	}
 	return uri, nil
 }
 
 func (s service) SignIn(ctx context.Context, login string, dto AuthUserDTO) (string, error) {
-	s.logger.Info("sign in user")
-	s.logger.Debug("check if user exists")
-	u, err := s.storage.GetByLogin(ctx, login)
+	token, err := s.signIn(ctx, login, dto)
+	metrics.ObserveSignIn(metrics.SignInPassword, err)
+	return token, err
+}
+
+func (s service) signIn(ctx context.Context, login string, dto AuthUserDTO) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("sign in user")
+	u, err := s.authenticate(ctx, login, dto.Password)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("check if user is active")
+	if err = s.reactivate(ctx, &u); err != nil {
+		return "", err
+	}
+	logger.Debug("check if user is verified")
+	if u.IsPending {
+		logger.Debug("user is not verified")
+		return "", problem.NotVerified.WithDetail("email is not verified, follow the link sent to your email")
+	}
+	logger.Debug("generate auth token")
+	token, err := s.authMw.GetToken(ctx, u.Login, u.Roles)
 	if err != nil {
-		s.logger.Debug("user not found")
+		logger.Debugf("error during getting auth token: %v", err)
 		return "", err
 	}
-	s.logger.Debug("check if user is active")
+	logger.Debug("user signed in")
+	return token, nil
+}
+
+func (s service) CheckCredentials(ctx context.Context, login string, password string) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("check user's credentials")
+	u, err := s.authenticate(ctx, login, password)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("check if user is active")
+	if !u.IsActive {
+		logger.Debug("user is not active")
+		return "", problem.WrongCredentials.WithDetail("user was deleted")
+	}
+	logger.Debug("check if user is verified")
+	if u.IsPending {
+		logger.Debug("user is not verified")
+		return "", problem.NotVerified
+	}
+	return u.Login, nil
+}
+
+// GetPrincipal resolves login of client certificate, only active verified
+// users are authorized and their stored roles are granted.
+func (s service) GetPrincipal(ctx context.Context, login string) (auth.Principal, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("get principal of user")
+	u, err := s.storage.GetByLogin(ctx, login)
+	if errors.Is(err, problem.NotFound) {
+		logger.Debug("user not found")
+		return auth.Principal{}, problem.Unauthorized.WithDetail("certificate is not mapped to existing user")
+	} else if err != nil {
+		logger.Debugf("error during getting user from storage: %v", err)
+		return auth.Principal{}, err
+	}
+	logger.Debug("check if user is active")
 	if !u.IsActive {
-		s.logger.Debug("user is not active")
-		authErr := uerror.ErrorWrongCredentials
-		authErr.Message = "user was deleted"
-		return "", authErr
-	}
-	s.logger.Debug("check password")
-	if err = u.CheckPassword(dto.Password); err != nil {
-		s.logger.Debug("wrong password")
-		authErr := uerror.ErrorWrongCredentials
-		authErr.Err = err
-		authErr.Message = "wrong password provided"
-		return "", authErr
-	}
-	s.logger.Debug("generate auth token")
-	token, err := s.authMw.GetToken(ctx, login)
-	if err != nil {
-		s.logger.Debugf("error during getting auth token: %v", err)
+		logger.Debug("user is not active")
+		return auth.Principal{}, problem.Unauthorized.WithDetail("user was deleted")
+	}
+	logger.Debug("check if user is verified")
+	if u.IsPending {
+		logger.Debug("user is not verified")
+		return auth.Principal{}, problem.NotVerified
+	}
+	return auth.Principal{Login: u.Login, Roles: u.Roles}, nil
+}
+
+// authenticate checks credentials by authenticator and returns local user
+// they belong to. Users of external backends are provisioned on first sign
+// in, their roles are updated on every sign in.
+func (s service) authenticate(ctx context.Context, login string, password string) (User, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("authenticate user")
+	identity, err := s.authenticator.Authenticate(ctx, login, password)
+	if err != nil {
+		logger.Debugf("authentication failed: %v", err)
+		return User{}, err
+	}
+	var u User
+	if identity.External == nil {
+		logger.Debug("get authenticated user")
+		return s.storage.GetByLogin(ctx, identity.Login)
+	}
+	logger.Debug("find user linked to external identity")
+	u, err = s.storage.GetByExternalIdentity(ctx, identity.External.Identity)
+	if errors.Is(err, problem.NotFound) {
+		logger.Debugf("linked user not found, provision new user: %v", err)
+		if u, err = s.provisionExternal(ctx, *identity.External); err != nil {
+			logger.Debugf("error during provisioning user: %v", err)
+			return User{}, err
+		}
+	} else if err != nil {
+		logger.Debugf("error during getting linked user: %v", err)
+		return User{}, err
+	}
+	if !equalRoles(u.Roles, identity.Roles) {
+		logger.Debug("update user's roles")
+		u.Roles = identity.Roles
+		if err = s.storage.Update(ctx, u); err != nil {
+			logger.Debugf("error during updating user in storage: %v", err)
+			return User{}, err
+		}
+	}
+	return u, nil
+}
+
+// reactivate restores deactivated user within grace period.
+func (s service) reactivate(ctx context.Context, u *User) error {
+	logger := logging.FromContext(ctx, s.logger)
+	if u.IsActive {
+		return nil
+	}
+	if !u.CanBeReactivated(time.Now(), s.options.Deletion.GracePeriod) {
+		logger.Debug("user is not active")
+		return problem.WrongCredentials.WithDetail("user was deleted")
+	}
+	logger.Debug("reactivate user within grace period")
+	u.IsActive = true
+	u.DeactivatedAt = nil
+	if err := s.storage.Update(ctx, *u); err != nil {
+		logger.Debugf("error during updating user in storage: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s service) SignInExternal(ctx context.Context, dto ExternalSignInDTO) (string, error) {
+	token, err := s.signInExternal(ctx, dto)
+	metrics.ObserveSignIn(metrics.SignInExternal, err)
+	return token, err
+}
+
+func (s service) signInExternal(ctx context.Context, dto ExternalSignInDTO) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("sign in user authenticated by external identity provider")
+	logger.Debug("find user linked to external identity")
+	u, err := s.storage.GetByExternalIdentity(ctx, dto.Identity)
+	if errors.Is(err, problem.NotFound) {
+		logger.Debugf("linked user not found, provision new user: %v", err)
+		if u, err = s.provisionExternal(ctx, dto); err != nil {
+			logger.Debugf("error during provisioning user: %v", err)
+			return "", err
+		}
+	} else if err != nil {
+		logger.Debugf("error during getting linked user: %v", err)
+		return "", err
+	}
+	logger.Debug("check if user is active")
+	if err = s.reactivate(ctx, &u); err != nil {
+		return "", err
+	}
+	logger.Debug("generate auth token")
+	token, err := s.authMw.GetToken(ctx, u.Login, u.Roles)
+	if err != nil {
+		logger.Debugf("error during getting auth token: %v", err)
 		return "", err
 	}
-	s.logger.Debug("user signed in")
+	logger.Debug("user signed in")
 	return token, nil
 }
 
-func (s service) ChangePassword(ctx context.Context, authStr string, dto UpdateUserDTO) error {
-	s.logger.Info("change user's password")
-	s.logger.Debug("parse authStr")
-	authLogin, err := s.authMw.CheckAndParse(ctx, authStr)
+var loginUnsafeCharsRe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+func (s service) provisionExternal(ctx context.Context, dto ExternalSignInDTO) (User, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("choose login for new user")
+	base := loginUnsafeCharsRe.ReplaceAllString(dto.PreferredLogin, "_")
+	if base == "" || base == "_" {
+		base = "user"
+	}
+	login := base
+	for i := 2; ; i++ {
+		_, err := s.storage.GetByLogin(ctx, login)
+		if errors.Is(err, problem.NotFound) {
+			if reserved, err := s.storage.IsReserved(ctx, login); err != nil {
+				return User{}, err
+			} else if !reserved {
+				break
+			}
+		} else if err != nil {
+			logger.Debugf("error during checking if login %q is free: %v", login, err)
+			return User{}, err
+		}
+		login = base + "_" + strconv.Itoa(i)
+	}
+	logger.Debugf("provision user %q", login)
+	u := NewExternalUser(login, dto)
+	u.IsActive = true
+	logger.Debug("pass user to storage to save it")
+	if _, err := s.storage.Save(ctx, u); err != nil {
+		logger.Debugf("error during saving user to storage: %v", err)
+		return User{}, err
+	}
+	return s.storage.GetByLogin(ctx, login)
+}
+
+func (s service) ChangePassword(ctx context.Context, dto UpdateUserDTO) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("change user's password")
+	logger.Debug("authorize request")
+	principal, err := auth.Authorize(ctx)
 	if err != nil {
-		s.logger.Debug("error during parsing authStr")
+		logger.Debug("error during authorization")
 		return err
 	}
-	s.logger.Debug("check if user exists")
+	authLogin := principal.Login
+	logger.Debug("check if user exists")
 	u, err := s.storage.GetByLogin(ctx, authLogin)
 	if err != nil {
-		s.logger.Debug("user not found")
+		logger.Debug("user not found")
 		return err
 	}
-	s.logger.Debug("check password")
+	logger.Debug("check password")
 	if err = u.CheckPassword(dto.OldPassword); err != nil {
-		s.logger.Debug("wrong password")
-		authErr := uerror.ErrorWrongCredentials
-		authErr.Err = err
-		authErr.Message = "wrong old password provided"
-		return authErr
+		logger.Debug("wrong password")
+		return problem.WrongCredentials.Wrap(err).WithDetail("wrong old password provided")
 	}
-	s.logger.Debug("check if passwords matching")
+	logger.Debug("check if passwords matching")
 	if match := dto.NewPassword == dto.RepeatNewPassword; !match {
-		s.logger.Debug("new passwords does not match")
-		err := uerror.ErrorPasswordsMismatch
-		err.Message = "new passwords does not match"
-		return err
+		logger.Debug("new passwords does not match")
+		return problem.PasswordsMismatch.WithDetail("new passwords does not match")
 	}
-	s.logger.Debug("check if user is active")
+	logger.Debug("check if user is active")
 	if !u.IsActive {
-		s.logger.Debug("user is not active")
-		err := uerror.ErrorWrongCredentials
-		err.Message = "user was deleted"
+		logger.Debug("user is not active")
+		return problem.WrongCredentials.WithDetail("user was deleted")
+	}
+	logger.Debug("create user from dto")
+	nU := UpdateUser(u, dto)
+	logger.Debug("generate password hash")
+	if err = nU.GeneratePasswordHash(); err != nil {
+		logger.Debugf("error during password hashing: %v", err)
 		return err
 	}
-	s.logger.Debug("create user from dto")
-	nU := UpdateUser(u.Id, u.Login, dto)
-	nU.IsActive = u.IsActive
-	s.logger.Debug("pass user to storage to update it")
+	logger.Debug("pass user to storage to update it")
 	if err = s.storage.Update(ctx, nU); err != nil {
-		s.logger.Debugf("error during updating user in storage: %v", err)
+		logger.Debugf("error during updating user in storage: %v", err)
+		return err
+	}
+	logger.Debug("user updated")
+	logger.Debug("revoke all user's sessions")
+	if err = s.authMw.RevokeTokens(ctx, u.Login); err != nil {
+		logger.Debugf("error during revoking sessions: %v", err)
 		return err
 	}
-	s.logger.Debug("user updated")
 	return nil
 }
 
-func (s service) DeleteUser(ctx context.Context, authStr string, login string) error {
-	s.logger.Info("delete user")
-	s.logger.Debug("parse authStr")
-	authLogin, err := s.authMw.CheckAndParse(ctx, authStr)
+func (s service) DeleteUser(ctx context.Context, login string, purge bool) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("delete user")
+	logger.Debug("authorize request")
+	principal, err := auth.Authorize(ctx)
 	if err != nil {
-		s.logger.Debug("error during parsing authStr")
+		logger.Debug("error during authorization")
 		return err
 	}
-	s.logger.Debug("check if request is authorized")
+	authLogin := principal.Login
+	logger.Debug("check if request is authorized")
 	if authLogin != login {
-		s.logger.Debug("logins mismatch")
-		err := uerror.ErrorNoAuth
-		err.DeveloperMessage = "attempt to delete another user"
-		return err
+		logger.Debug("logins mismatch")
+		return problem.Forbidden.WithDetail("attempt to delete another user")
 	}
-	s.logger.Debug("check if user exists")
+	logger.Debug("check if user exists")
 	u, err := s.storage.GetByLogin(ctx, authLogin)
 	if err != nil {
-		s.logger.Debug("user not found")
+		logger.Debug("user not found")
 		return err
 	}
-	s.logger.Debug("check if user is active")
+	logger.Debug("check if user is active")
 	if !u.IsActive {
-		s.logger.Debug("user is not active")
-		err := uerror.ErrorWrongCredentials
-		err.Message = "user was deleted"
-		return err
+		logger.Debug("user is not active")
+		return problem.WrongCredentials.WithDetail("user was deleted")
+	}
+	if purge {
+		logger.Debug("purge user immediately")
+		return s.purge(ctx, u.Login)
 	}
-	s.logger.Debug("set user's status to 'not active'")
+	logger.Debug("set user's status to 'not active'")
+	now := time.Now()
 	u.IsActive = false
-	s.logger.Debug("pass user to storage to update it")
+	u.DeactivatedAt = &now
+	logger.Debug("pass user to storage to update it")
 	if err = s.storage.Update(ctx, u); err != nil {
-		s.logger.Debugf("error duting updating user: %v", err)
+		logger.Debugf("error duting updating user: %v", err)
+		return err
+	}
+	logger.Debug("revoke all user's sessions")
+	if err = s.authMw.RevokeTokens(ctx, u.Login); err != nil {
+		logger.Debugf("error during revoking sessions: %v", err)
+		return err
+	}
+	logger.Debug("user deleted")
+	return nil
+}
+
+func (s service) Rename(ctx context.Context, login string, dto RenameUserDTO) (string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("rename user")
+	u, err := s.getAuthorizedUser(ctx, login, "attempt to rename another user")
+	if err != nil {
+		return "", err
+	}
+	if u.HasPassword() {
+		logger.Debug("check password")
+		if err = u.CheckPassword(dto.Password); err != nil {
+			logger.Debug("wrong password")
+			return "", problem.WrongCredentials.Wrap(err).WithDetail("wrong password provided")
+		}
+	} else {
+		logger.Debug("user has no password, authorized principal is enough")
+	}
+	logger.Debug("validate new login")
+	if err = validateLogin(dto.NewLogin); err != nil {
+		logger.Debugf("invalid login: %v", err)
+		return "", problem.Validation.WithDetail(err.Error())
+	}
+	if dto.NewLogin == login {
+		logger.Debug("login is not changed")
+		return login, nil
+	}
+	logger.Debug("check if new login is reserved")
+	if err = s.checkLoginIsFree(ctx, dto.NewLogin); err != nil {
+		return "", err
+	}
+	logger.Debug("rename user and reserve old login in storage")
+	if err = s.storage.Rename(ctx, login, dto.NewLogin, s.options.Rename.ReservationPeriod); err != nil {
+		logger.Debugf("error during renaming user in storage: %v", err)
+		return "", err
+	}
+	logger.Debug("migrate notes authorship")
+	if err = s.notes.ChangeAuthor(ctx, login, dto.NewLogin); err != nil {
+		logger.Debugf("error during migrating notes, rollback renaming: %v", err)
+		if rbErr := s.storage.Rename(ctx, dto.NewLogin, login, 0); rbErr != nil {
+			logger.Debugf("error during rollback of renaming: %v", rbErr)
+			return "", fmt.Errorf("rollback of renaming %q to %q failed: %v: %w", login, dto.NewLogin, rbErr, err)
+		}
+		return "", err
+	}
+	logger.Debug("revoke tokens of old login")
+	if err = s.authMw.RevokeTokens(ctx, login); err != nil {
+		logger.Debugf("error during revoking tokens: %v", err)
+		return "", fmt.Errorf("user was renamed to %q, but tokens of old login were not revoked: %w",
+			dto.NewLogin, err)
+	}
+	logger.Debug("user renamed")
+	return dto.NewLogin, nil
+}
+
+func (s service) checkLoginIsFree(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	reserved, err := s.storage.IsReserved(ctx, login)
+	if err != nil {
+		logger.Debugf("error during checking login reservation: %v", err)
+		return err
+	}
+	if reserved {
+		logger.Debug("login is reserved")
+		return problem.Conflict.WithDetail("login is reserved")
+	}
+	return nil
+}
+
+func (s service) ListSessions(ctx context.Context, login string) ([]SessionDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("list user's sessions")
+	u, err := s.getAuthorizedUser(ctx, login, "attempt to list another user's sessions")
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("get sessions")
+	sessions, err := s.authMw.ListSessions(ctx, u.Login)
+	if err != nil {
+		logger.Debugf("error during getting sessions: %v", err)
+		return nil, err
+	}
+	dtos := []SessionDTO{}
+	now := time.Now()
+	for _, session := range sessions {
+		if session.IsActive(now) {
+			dtos = append(dtos, NewSessionDTO(session))
+		}
+	}
+	return dtos, nil
+}
+
+func (s service) RevokeSession(ctx context.Context, login string, id string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("revoke user's session")
+	u, err := s.getAuthorizedUser(ctx, login, "attempt to revoke another user's session")
+	if err != nil {
+		return err
+	}
+	logger.Debug("check if session belongs to user")
+	sessions, err := s.authMw.ListSessions(ctx, u.Login)
+	if err != nil {
+		logger.Debugf("error during getting sessions: %v", err)
+		return err
+	}
+	for _, session := range sessions {
+		if session.Id == id && session.IsActive(time.Now()) {
+			logger.Debug("pass session to auth service to revoke it")
+			return s.authMw.RevokeSession(ctx, id)
+		}
+	}
+	logger.Debug("session not found")
+	return problem.NotFound.WithDetail("session not found")
+}
+
+func (s service) GetProfile(ctx context.Context, login string) (ProfileDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("get user's profile")
+	u, err := s.getAuthorizedUser(ctx, login, "attempt to read another user's profile")
+	if err != nil {
+		return ProfileDTO{}, err
+	}
+	return NewProfile(u), nil
+}
+
+func (s service) UpdateProfile(ctx context.Context, login string, dto PatchUserDTO) (ProfileDTO, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("update user's profile")
+	u, err := s.getAuthorizedUser(ctx, login, "attempt to update another user's profile")
+	if err != nil {
+		return ProfileDTO{}, err
+	}
+	logger.Debug("apply changes to user")
+	nU := PatchUser(u, dto)
+	logger.Debug("validate profile")
+	if err = validateProfile(nU); err != nil {
+		logger.Debugf("invalid profile: %v", err)
+		return ProfileDTO{}, problem.Validation.WithDetail(err.Error())
+	}
+	verifyEmail := false
+	if dto.Email != nil && *dto.Email == u.Email {
+		logger.Debug("email is not changed, drop pending email")
+		nU.PendingEmail = ""
+	} else if nU.Email != u.Email && s.options.Verification.Enabled {
+		logger.Debug("email changed, it has to be verified")
+		if nU.Email == "" {
+			return ProfileDTO{}, problem.Validation.WithDetail("valid email is required")
+		}
+		if !u.IsPending {
+			logger.Debug("keep verified email until the new one is verified")
+			nU.PendingEmail = nU.Email
+			nU.Email = u.Email
+		}
+		now := time.Now()
+		nU.VerificationSentAt = &now
+		verifyEmail = true
+	}
+	logger.Debug("pass user to storage to update it")
+	if err = s.storage.Update(ctx, nU); err != nil {
+		logger.Debugf("error during updating user in storage: %v", err)
+		return ProfileDTO{}, err
+	}
+	if verifyEmail {
+		logger.Debug("send verification link")
+		email := nU.Email
+		if nU.PendingEmail != "" {
+			email = nU.PendingEmail
+		}
+		if err := s.sendVerification(ctx, nU, email); err != nil {
+			logger.Warnf("error during sending verification link, it can be re-sent later: %v", err)
+		}
+	}
+	logger.Debug("profile updated")
+	return NewProfile(nU), nil
+}
+
+func (s service) getAuthorizedUser(ctx context.Context, login string, action string) (User, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("authorize request")
+	principal, err := auth.Authorize(ctx)
+	if err != nil {
+		logger.Debug("error during authorization")
+		return User{}, err
+	}
+	authLogin := principal.Login
+	logger.Debug("check if request is authorized")
+	if authLogin != login {
+		logger.Debug("logins mismatch")
+		return User{}, problem.Forbidden.WithDetail(action)
+	}
+	logger.Debug("check if user exists")
+	u, err := s.storage.GetByLogin(ctx, authLogin)
+	if err != nil {
+		logger.Debug("user not found")
+		return User{}, err
+	}
+	logger.Debug("check if user is active")
+	if !u.IsActive {
+		logger.Debug("user is not active")
+		return User{}, problem.WrongCredentials.WithDetail("user was deleted")
+	}
+	return u, nil
+}
+
+func (s service) PurgeDeactivated(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("purge deactivated users")
+	logger.Debug("get all users from storage")
+	users, err := s.storage.GetAll(ctx)
+	if err != nil {
+		logger.Debugf("error during getting users from storage: %v", err)
+		return 0, err
+	}
+	now := time.Now()
+	purged := 0
+	var (
+		failed   []string
+		firstErr error
+	)
+	for _, u := range users {
+		if !u.IsPurgeDue(now, s.options.Deletion.GracePeriod) {
+			continue
+		}
+		logger.Debugf("grace period of user %q is over", u.Login)
+		if err := s.purge(ctx, u.Login); err != nil {
+			logger.Errorf("error during purging user %q: %v", u.Login, err)
+			failed = append(failed, fmt.Sprintf("%q: %v", u.Login, err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged++
+	}
+	logger.Debugf("purged %d users", purged)
+	if firstErr != nil {
+		// the first error is wrapped, so that its problem is reported
+		return purged, fmt.Errorf("failed to purge %d users (%s): %w", len(failed),
+			strings.Join(failed, "; "), firstErr)
+	}
+	return purged, nil
+}
+
+// purge deletes user with all of his notes, exports and sessions. Tokens are revoked
+// first, so that they do not become valid for another user taking the
+// login afterwards.
+func (s service) purge(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debugf("revoke tokens of user %q", login)
+	if err := s.authMw.RevokeTokens(ctx, login); err != nil {
+		logger.Debugf("error during revoking tokens: %v", err)
+		return err
+	}
+	logger.Debugf("delete notes of user %q", login)
+	if err := s.notes.DeleteAll(ctx, login); err != nil {
+		logger.Debugf("error during deleting notes: %v", err)
+		return err
+	}
+	if s.exports != nil {
+		logger.Debugf("delete exports of user %q", login)
+		if err := s.exports.DeleteAll(ctx, login); err != nil {
+			logger.Debugf("error during deleting exports: %v", err)
+			return err
+		}
+	}
+	logger.Debugf("delete user %q", login)
+	if err := s.storage.DeleteByLogin(ctx, login); err != nil {
+		logger.Debugf("error during deleting user: %v", err)
+		return err
+	}
+	logger.Debugf("delete sessions of user %q", login)
+	if err := s.authMw.DeleteSessions(ctx, login); err != nil {
+		logger.Debugf("error during deleting sessions: %v", err)
+		return err
+	}
+	logger.Debug("user purged")
+	return nil
+}
+
+func (s service) VerifyEmail(ctx context.Context, login string, token string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("verify user's email")
+	logger.Debug("parse verification token")
+	tokenLogin, tokenEmail, err := s.authMw.CheckVerificationToken(ctx, token)
+	if err != nil {
+		logger.Debugf("error during parsing verification token: %v", err)
+		return problem.Unauthorized.Wrap(err).WithDetail("invalid or expired verification link")
+	}
+	logger.Debug("check if token issued for this user")
+	if tokenLogin != login {
+		logger.Debug("logins mismatch")
+		return problem.Forbidden.WithDetail("attempt to verify another user")
+	}
+	logger.Debug("check if user exists")
+	u, err := s.storage.GetByLogin(ctx, login)
+	if err != nil {
+		logger.Debug("user not found")
+		return err
+	}
+	logger.Debug("check if token issued for email to verify")
+	switch {
+	case u.PendingEmail != "" && tokenEmail == u.PendingEmail:
+		logger.Debug("replace email with verified pending one")
+		u.Email = u.PendingEmail
+		u.PendingEmail = ""
+	case u.IsPending && tokenEmail == u.Email:
+		logger.Debug("verify user's email")
+		u.IsPending = false
+	case !u.IsPending && u.PendingEmail == "":
+		logger.Debug("user already verified")
+		return problem.AlreadyVerified
+	default:
+		logger.Debug("token was issued for another email")
+		return problem.Unauthorized.WithDetail("verification link was issued for another email")
+	}
+	logger.Debug("pass user to storage to update it")
+	if err = s.storage.Update(ctx, u); err != nil {
+		logger.Debugf("error during updating user in storage: %v", err)
+		return err
+	}
+	logger.Debug("user verified")
+	return nil
+}
+
+// ResendVerification sends verification link again. It does not report
+// whether login exists or is verified already, so that it can not be used
+// to enumerate users, and does not send links more often than once per
+// resend interval.
+func (s service) ResendVerification(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("resend verification link")
+	logger.Debug("check if user exists")
+	u, err := s.storage.GetByLogin(ctx, login)
+	if errors.Is(err, problem.NotFound) {
+		logger.Debug("user not found")
+		return nil
+	}
+	if err != nil {
+		logger.Debugf("error during getting user from storage: %v", err)
+		return err
+	}
+	logger.Debug("check if user has email to verify")
+	email := u.PendingEmail
+	if u.IsPending {
+		email = u.Email
+	}
+	if email == "" {
+		logger.Debug("user already verified")
+		return nil
+	}
+	now := time.Now()
+	if u.VerificationSentAt != nil && now.Before(u.VerificationSentAt.Add(s.options.Verification.ResendInterval)) {
+		logger.Debug("verification link was sent recently")
+		return nil
+	}
+	u.VerificationSentAt = &now
+	logger.Debug("pass user to storage to update it")
+	if err = s.storage.Update(ctx, u); err != nil {
+		logger.Debugf("error during updating user in storage: %v", err)
+		return err
+	}
+	return s.sendVerification(ctx, u, email)
+}
+
+// sendVerification sends link verifying email of u, token of the link is
+// valid for this email only.
+func (s service) sendVerification(ctx context.Context, u User, email string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debug("generate verification token")
+	token, err := s.authMw.GetVerificationToken(ctx, u.Login, email, s.options.Verification.TokenTTL)
+	if err != nil {
+		logger.Debugf("error during generating verification token: %v", err)
+		return err
+	}
+	link := fmt.Sprintf("%s/api/v1/users/%s/verify?token=%s",
+		s.options.Verification.LinkBaseUrl, url.PathEscape(u.Login), url.QueryEscape(token))
+	logger.Tracef("verification link: %s", link)
+	body := fmt.Sprintf("Hello, %s!\n\nPlease confirm your email by following the link below:\n%s\n\n"+
+		"The link is valid for %s.\n", u.Login, link, s.options.Verification.TokenTTL)
+	logger.Debug("pass verification link to mailer")
+	if err = s.mailer.Send(ctx, email, "Confirm your email", body); err != nil {
+		logger.Debugf("error during sending verification link: %v", err)
 		return err
 	}
-	s.logger.Debug("user deleted")
 	return nil
 }
@@ -0,0 +1,232 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	authStorage "github.com/Frank-Way/note-go-rest-service/internal/auth/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/mail/mailer"
+	noteStorage "github.com/Frank-Way/note-go-rest-service/internal/note/storage"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	userStorage "github.com/Frank-Way/note-go-rest-service/internal/user/storage"
+	"github.com/sirupsen/logrus"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testIdentity = user.ExternalIdentity{Provider: "test", Subject: "subject-1"}
+
+// failingStorage fails lookups of external identities as unavailable
+// storage does.
+type failingStorage struct {
+	user.Storage
+}
+
+func (fs failingStorage) GetByExternalIdentity(ctx context.Context, identity user.ExternalIdentity) (user.User, error) {
+	return user.User{}, problem.Storage.Wrap(errors.New("connection refused"))
+}
+
+// externalAuthenticator authenticates everyone as external identity.
+type externalAuthenticator struct{}
+
+func (externalAuthenticator) Authenticate(ctx context.Context, login string, password string) (user.Identity, error) {
+	return user.Identity{External: &user.ExternalSignInDTO{
+		Identity:       testIdentity,
+		PreferredLogin: login,
+	}}, nil
+}
+
+// fakeExports records purged logins and fails purging of failLogin.
+type fakeExports struct {
+	failLogin string
+	deleted   []string
+}
+
+func (fe *fakeExports) DeleteAll(ctx context.Context, login string) error {
+	if login == fe.failLogin {
+		return problem.Storage.Wrap(errors.New("connection refused"))
+	}
+	fe.deleted = append(fe.deleted, login)
+	return nil
+}
+
+// failingNotes fails migration of notes.
+type failingNotes struct {
+	user.NoteStorage
+}
+
+func (fn failingNotes) ChangeAuthor(ctx context.Context, login string, newLogin string) error {
+	return problem.Storage.Wrap(errors.New("connection refused"))
+}
+
+func newTestService(storage user.Storage) user.Service {
+	return newTestServiceWith(storage, nil, nil, user.Options{})
+}
+
+// newTestServiceWith returns service with in-memory note storage when
+// notes is nil.
+func newTestServiceWith(storage user.Storage, notes user.NoteStorage, exports user.Exports,
+	options user.Options) user.Service {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	if notes == nil {
+		notes = noteStorage.NewInMemoryStorage(logger)
+	}
+	authSrv := auth.NewAuthService(authStorage.NewInMemorySessionStorage(logger), logger)
+	return user.NewService(authSrv, storage, externalAuthenticator{}, notes, exports,
+		mailer.NewLogMailer(logger), options, logger)
+}
+
+func newTestStorage() user.Storage {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return userStorage.NewInMemoryStorage(logger)
+}
+
+func TestSignInExternal_StorageFailure(t *testing.T) {
+	storage := newTestStorage()
+	s := newTestService(failingStorage{Storage: storage})
+
+	_, err := s.SignInExternal(context.Background(), user.ExternalSignInDTO{
+		Identity:       testIdentity,
+		PreferredLogin: "alice",
+	})
+	if !errors.Is(err, problem.Storage) {
+		t.Errorf("error = %v, want storage problem", err)
+	}
+	assertNoUsers(t, storage)
+}
+
+func TestCheckCredentials_StorageFailure(t *testing.T) {
+	storage := newTestStorage()
+	s := newTestService(failingStorage{Storage: storage})
+
+	if _, err := s.CheckCredentials(context.Background(), "alice", "secret"); !errors.Is(err, problem.Storage) {
+		t.Errorf("error = %v, want storage problem", err)
+	}
+	assertNoUsers(t, storage)
+}
+
+func TestSignInExternal_ProvisionsOnce(t *testing.T) {
+	storage := newTestStorage()
+	s := newTestService(storage)
+	dto := user.ExternalSignInDTO{Identity: testIdentity, PreferredLogin: "alice"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.SignInExternal(context.Background(), dto); err != nil {
+			t.Fatalf("sign in #%d: unexpected error: %v", i+1, err)
+		}
+	}
+	users, err := storage.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("get users: %v", err)
+	}
+	if len(users) != 1 || users[0].Login != "alice" {
+		t.Errorf("users = %+v, want single user alice", users)
+	}
+}
+
+func TestPurgeDeactivated_ContinuesAfterFailure(t *testing.T) {
+	storage := newTestStorage()
+	exports := &fakeExports{failLogin: "bob"}
+	s := newTestServiceWith(storage, nil, exports, user.Options{})
+	ctx := context.Background()
+	deactivatedAt := time.Now().Add(-time.Hour)
+	for _, login := range []string{"alice", "bob", "carol"} {
+		if _, err := storage.Save(ctx, user.User{Login: login, Password: "secret"}); err != nil {
+			t.Fatalf("save user %s: %v", login, err)
+		}
+		u, err := storage.GetByLogin(ctx, login)
+		if err != nil {
+			t.Fatalf("get user %s: %v", login, err)
+		}
+		u.DeactivatedAt = &deactivatedAt
+		if err = storage.Update(ctx, u); err != nil {
+			t.Fatalf("update user %s: %v", login, err)
+		}
+	}
+
+	purged, err := s.PurgeDeactivated(ctx)
+	if !errors.Is(err, problem.Storage) || !strings.Contains(err.Error(), `"bob"`) {
+		t.Errorf("error = %v, want storage problem of bob", err)
+	}
+	if purged != 2 {
+		t.Errorf("purged = %d, want 2", purged)
+	}
+	sort.Strings(exports.deleted)
+	if !reflect.DeepEqual(exports.deleted, []string{"alice", "carol"}) {
+		t.Errorf("exports deleted of %v, want alice and carol", exports.deleted)
+	}
+	users, err := storage.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("get users: %v", err)
+	}
+	if len(users) != 1 || users[0].Login != "bob" {
+		t.Errorf("users = %+v, want only bob to be kept", users)
+	}
+}
+
+func TestRename(t *testing.T) {
+	renameOptions := user.Options{Rename: user.RenameOptions{ReservationPeriod: time.Hour}}
+	tests := []struct {
+		name        string
+		password    string
+		dtoPassword string
+		notes       user.NoteStorage
+		wantErr     error
+		wantLogin   string
+		reserved    bool
+	}{
+		{name: "with password", password: "secret", dtoPassword: "secret", wantLogin: "bob", reserved: true},
+		{name: "wrong password", password: "secret", dtoPassword: "wrong", wantErr: problem.WrongCredentials,
+			wantLogin: "alice"},
+		{name: "external user without password", wantLogin: "bob", reserved: true},
+		{name: "failed migration of notes is rolled back", password: "secret", dtoPassword: "secret",
+			notes: failingNotes{}, wantErr: problem.Storage, wantLogin: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage()
+			s := newTestServiceWith(storage, tt.notes, nil, renameOptions)
+			ctx := auth.WithPrincipal(context.Background(), auth.Principal{Login: "alice", SessionId: "session-1"})
+			if _, err := storage.Save(ctx, user.User{Login: "alice", Password: tt.password, IsActive: true}); err != nil {
+				t.Fatalf("save user: %v", err)
+			}
+
+			_, err := s.Rename(ctx, "alice", user.RenameUserDTO{NewLogin: "bob", Password: tt.dtoPassword})
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			users, err := storage.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("get users: %v", err)
+			}
+			if len(users) != 1 || users[0].Login != tt.wantLogin {
+				t.Errorf("users = %+v, want single user %s", users, tt.wantLogin)
+			}
+			reserved, err := storage.IsReserved(ctx, "alice")
+			if err != nil {
+				t.Fatalf("check reservation: %v", err)
+			}
+			if reserved != tt.reserved {
+				t.Errorf("old login reserved = %v, want %v", reserved, tt.reserved)
+			}
+		})
+	}
+}
+
+func assertNoUsers(t *testing.T, storage user.Storage) {
+	t.Helper()
+	users, err := storage.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("get users: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("got %d users, want none to be provisioned", len(users))
+	}
+}
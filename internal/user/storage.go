@@ -1,13 +1,33 @@
 package user
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Storage interface {
 	Save(ctx context.Context, user User) (string, error)
 	GetByLogin(ctx context.Context, login string) (User, error)
+	GetByExternalIdentity(ctx context.Context, identity ExternalIdentity) (User, error)
 	GetById(ctx context.Context, id int) (User, error)
 	GetAll(ctx context.Context) (Users, error)
 	Update(ctx context.Context, user User) error
 	DeleteByLogin(ctx context.Context, login string) error
 	DeleteById(ctx context.Context, id int) error
+	// Rename changes login of user and reserves the old login for
+	// reservation period at once, reservation of new login is dropped.
+	Rename(ctx context.Context, login string, newLogin string, reservation time.Duration) error
+	IsReserved(ctx context.Context, login string) (bool, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type NoteStorage interface {
+	DeleteAll(ctx context.Context, login string) error
+	ChangeAuthor(ctx context.Context, login string, newLogin string) error
+}
+
+// Exports deletes export jobs of user together with their archives.
+type Exports interface {
+	DeleteAll(ctx context.Context, login string) error
 }
@@ -3,10 +3,12 @@ package storage
 import (
 	"context"
 	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
 	"github.com/Frank-Way/note-go-rest-service/internal/user"
-	"github.com/Frank-Way/note-go-rest-service/internal/user/uerror"
 	"github.com/sirupsen/logrus"
 	"sync"
+	"time"
 )
 
 var _ user.Storage = &inMemoryStorage{}
@@ -15,163 +17,216 @@ type inMemoryStorage struct {
 	sync.Mutex
 	logger *logrus.Logger
 
-	users  map[int]user.User
-	nextId int
+	users    map[int]user.User
+	reserved map[string]time.Time
+	nextId   int
 }
 
 func NewInMemoryStorage(logger *logrus.Logger) user.Storage {
 	ims := &inMemoryStorage{}
 	ims.logger = logger
 	ims.users = make(map[int]user.User)
+	ims.reserved = make(map[string]time.Time)
 	ims.nextId = 1
 	return ims
 }
 
 func (ims *inMemoryStorage) Save(ctx context.Context, user user.User) (string, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("save user to in_memory_storage")
-	ims.logger.Debug("check if user exists")
-	exists, _ := ims.findUserByLogin(user.Login)
+	logger.Info("save user to in_memory_storage")
+	logger.Debug("check if user exists")
+	exists, _ := ims.findUserByLogin(ctx, user.Login)
 	if exists {
-		ims.logger.Debug("user already exists in memory")
-		err := uerror.ErrorDuplicate
-		err.Message = fmt.Sprintf("there are user with specified login '%s'", user.Login)
-		return "", err
+		logger.Debug("user already exists in memory")
+		return "", problem.Conflict.WithDetail(fmt.Sprintf("there are user with specified login '%s'", user.Login))
 	}
-	ims.logger.Debug("generate password hash")
+	logger.Debug("generate password hash")
 	if err := user.GeneratePasswordHash(); err != nil {
-		ims.logger.Debugf("error during password hashing: %v", err)
+		logger.Debugf("error during password hashing: %v", err)
 		return "", err
 	}
 	user.Id = ims.nextId
 	ims.nextId++
 	ims.users[user.Id] = user
-	ims.logger.Debug("user was saved")
+	logger.Debug("user was saved")
 	return user.Login, nil
 }
 
 func (ims *inMemoryStorage) GetByLogin(ctx context.Context, login string) (user.User, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("get user from in_memory_storage")
-	ims.logger.Debug("check if user exists")
-	exists, u := ims.findUserByLogin(login)
+	logger.Info("get user from in_memory_storage")
+	logger.Debug("check if user exists")
+	exists, u := ims.findUserByLogin(ctx, login)
 	if exists {
-		ims.logger.Debug("user found")
+		logger.Debug("user found")
 		return u, nil
 	} else {
-		ims.logger.Debugf("user was not found, login: %s", login)
-		err := uerror.ErrorNotFound
-		err.Message = fmt.Sprintf("user with login '%s' not found", login)
-		return user.User{}, err
+		logger.Debugf("user was not found, login: %s", login)
+		return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
+	}
+}
+
+func (ims *inMemoryStorage) GetByExternalIdentity(ctx context.Context, identity user.ExternalIdentity) (user.User, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("get user by external identity from in_memory_storage")
+	for _, u := range ims.users {
+		if u.HasExternalIdentity(identity) {
+			logger.Debug("user found")
+			return u, nil
+		}
 	}
+	logger.Debugf("user was not found, identity: %v", identity)
+	return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with %s identity '%s' not found", identity.Provider, identity.Subject))
 }
 
 func (ims *inMemoryStorage) GetById(ctx context.Context, id int) (user.User, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("get user from in_memory_storage")
-	ims.logger.Debugf("find user by id: %d", id)
+	logger.Info("get user from in_memory_storage")
+	logger.Debugf("find user by id: %d", id)
 	u, ok := ims.users[id]
 	if ok {
-		ims.logger.Debug("user found")
+		logger.Debug("user found")
 		return u, nil
 	} else {
-		ims.logger.Debugf("user was not found, id: %d", id)
-		err := uerror.ErrorNotFound
-		err.Message = fmt.Sprintf("user with id '%d' not found", id)
-		return user.User{}, err
+		logger.Debugf("user was not found, id: %d", id)
+		return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with id '%d' not found", id))
 	}
 }
 
 func (ims *inMemoryStorage) GetAll(ctx context.Context) (user.Users, error) {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("get users from in_memory_storage")
+	logger.Info("get users from in_memory_storage")
 	var res []user.User
 	for _, v := range ims.users {
 		res = append(res, v)
 	}
-	ims.logger.Debug("users found")
+	logger.Debug("users found")
 	return res, nil
 }
 
 func (ims *inMemoryStorage) Update(ctx context.Context, user user.User) error {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("update user in in_memory_storage")
-	ims.logger.Debugf("find user by id: %d", user.Id)
+	logger.Info("update user in in_memory_storage")
+	logger.Debugf("find user by id: %d", user.Id)
 	u, ok := ims.users[user.Id]
 	if ok {
-		ims.logger.Debug("user found")
-		ims.logger.Debug("update password")
-		u.Password = user.Password
-		ims.logger.Debug("hashing password")
-		if err := u.GeneratePasswordHash(); err != nil {
-			ims.logger.Debugf("error during password hashing: %v", err)
-			return err
-		}
-		ims.logger.Debug("update status")
-		u.IsActive = user.IsActive
-		ims.users[u.Id] = u
-		ims.logger.Debug("user updated")
+		logger.Debug("user found")
+		logger.Debug("update user fields")
+		user.Login = u.Login
+		ims.users[u.Id] = user
+		logger.Debug("user updated")
 		return nil
 	} else {
-		ims.logger.Debugf("user was not found, id: %d", user.Id)
-		err := uerror.ErrorNotFound
-		err.Message = fmt.Sprintf("user with id '%d' not found", user.Id)
-		return err
+		logger.Debugf("user was not found, id: %d", user.Id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("user with id '%d' not found", user.Id))
 	}
 }
 
 func (ims *inMemoryStorage) DeleteByLogin(ctx context.Context, login string) error {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("delete user from in_memory_storage")
-	ims.logger.Debugf("find user by login: %s", login)
-	exists, u := ims.findUserByLogin(login)
+	logger.Info("delete user from in_memory_storage")
+	logger.Debugf("find user by login: %s", login)
+	exists, u := ims.findUserByLogin(ctx, login)
 	if exists {
-		ims.logger.Debug("user found")
+		logger.Debug("user found")
 		delete(ims.users, u.Id)
-		ims.logger.Debug("user deleted")
+		logger.Debug("user deleted")
 		return nil
 	} else {
-		ims.logger.Debugf("user was not found, login: %s", login)
-		err := uerror.ErrorNotFound
-		err.Message = fmt.Sprintf("user with login '%s' not found", login)
-		return err
+		logger.Debugf("user was not found, login: %s", login)
+		return problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
 	}
 }
 
 func (ims *inMemoryStorage) DeleteById(ctx context.Context, id int) error {
+	logger := logging.FromContext(ctx, ims.logger)
 	ims.Lock()
 	defer ims.Unlock()
 
-	ims.logger.Info("delete user from in_memory_storage")
-	ims.logger.Debugf("find user by id: %d", id)
+	logger.Info("delete user from in_memory_storage")
+	logger.Debugf("find user by id: %d", id)
 	_, ok := ims.users[id]
 	if ok {
-		ims.logger.Debug("user found")
+		logger.Debug("user found")
 		delete(ims.users, id)
-		ims.logger.Debug("user deleted")
+		logger.Debug("user deleted")
 		return nil
 	} else {
-		ims.logger.Debugf("user was not found, id: %d", id)
-		err := uerror.ErrorNotFound
-		err.Message = fmt.Sprintf("user with id '%d' not found", id)
-		return err
+		logger.Debugf("user was not found, id: %d", id)
+		return problem.NotFound.WithDetail(fmt.Sprintf("user with id '%d' not found", id))
+	}
+}
+
+func (ims *inMemoryStorage) Rename(ctx context.Context, login string, newLogin string,
+	reservation time.Duration) error {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("rename user in in_memory_storage")
+	logger.Debug("check if new login is free")
+	if exists, _ := ims.findUserByLogin(ctx, newLogin); exists {
+		logger.Debug("new login is used by another user")
+		return problem.Conflict.WithDetail(fmt.Sprintf("there are user with specified login '%s'", newLogin))
+	}
+	logger.Debugf("find user by login: %s", login)
+	exists, u := ims.findUserByLogin(ctx, login)
+	if !exists {
+		logger.Debugf("user was not found, login: %s", login)
+		return problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
+	}
+	u.Login = newLogin
+	ims.users[u.Id] = u
+	delete(ims.reserved, newLogin)
+	if reservation > 0 {
+		ims.reserved[login] = time.Now().Add(reservation)
+	}
+	logger.Debug("user renamed")
+	return nil
+}
+
+func (ims *inMemoryStorage) IsReserved(ctx context.Context, login string) (bool, error) {
+	logger := logging.FromContext(ctx, ims.logger)
+	ims.Lock()
+	defer ims.Unlock()
+
+	logger.Info("check login reservation in in_memory_storage")
+	until, ok := ims.reserved[login]
+	if !ok {
+		return false, nil
 	}
+	if time.Now().After(until) {
+		logger.Debugf("reservation of login %q is over", login)
+		delete(ims.reserved, login)
+		return false, nil
+	}
+	return true, nil
 }
 
-func (ims *inMemoryStorage) findUserByLogin(login string) (bool, user.User) {
-	ims.logger.Debugf("check if login is free: %s", login)
+func (ims *inMemoryStorage) findUserByLogin(ctx context.Context, login string) (bool, user.User) {
+	logger := logging.FromContext(ctx, ims.logger)
+	logger.Debugf("check if login is free: %s", login)
 	for _, v := range ims.users {
 		if v.Login == login {
 			return true, v
@@ -179,3 +234,12 @@ func (ims *inMemoryStorage) findUserByLogin(login string) (bool, user.User) {
 	}
 	return false, user.User{}
 }
+
+func (ims *inMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ims *inMemoryStorage) Close() error {
+	ims.logger.Info("close user in_memory_storage")
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/metrics"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"github.com/Frank-Way/note-go-rest-service/internal/user"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+var _ user.Storage = &instrumentedStorage{}
+
+// instrumentedStorage records latency and spans of operations of wrapped storage.
+type instrumentedStorage struct {
+	storage user.Storage
+	backend string
+}
+
+func NewInstrumentedStorage(storage user.Storage, backend string) user.Storage {
+	return &instrumentedStorage{
+		storage: storage,
+		backend: backend,
+	}
+}
+
+func (is *instrumentedStorage) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, "user storage "+method,
+		attribute.String("storage.backend", is.backend))
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveStorage("user", is.backend, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (is *instrumentedStorage) Save(ctx context.Context, user user.User) (string, error) {
+	ctx, done := is.start(ctx, "Save")
+	login, err := is.storage.Save(ctx, user)
+	done(err)
+	return login, err
+}
+
+func (is *instrumentedStorage) GetByLogin(ctx context.Context, login string) (user.User, error) {
+	ctx, done := is.start(ctx, "GetByLogin")
+	u, err := is.storage.GetByLogin(ctx, login)
+	done(err)
+	return u, err
+}
+
+func (is *instrumentedStorage) GetByExternalIdentity(ctx context.Context, identity user.ExternalIdentity) (user.User, error) {
+	ctx, done := is.start(ctx, "GetByExternalIdentity")
+	u, err := is.storage.GetByExternalIdentity(ctx, identity)
+	done(err)
+	return u, err
+}
+
+func (is *instrumentedStorage) GetById(ctx context.Context, id int) (user.User, error) {
+	ctx, done := is.start(ctx, "GetById")
+	u, err := is.storage.GetById(ctx, id)
+	done(err)
+	return u, err
+}
+
+func (is *instrumentedStorage) GetAll(ctx context.Context) (user.Users, error) {
+	ctx, done := is.start(ctx, "GetAll")
+	users, err := is.storage.GetAll(ctx)
+	done(err)
+	return users, err
+}
+
+func (is *instrumentedStorage) Update(ctx context.Context, user user.User) error {
+	ctx, done := is.start(ctx, "Update")
+	err := is.storage.Update(ctx, user)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) DeleteByLogin(ctx context.Context, login string) error {
+	ctx, done := is.start(ctx, "DeleteByLogin")
+	err := is.storage.DeleteByLogin(ctx, login)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) DeleteById(ctx context.Context, id int) error {
+	ctx, done := is.start(ctx, "DeleteById")
+	err := is.storage.DeleteById(ctx, id)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Rename(ctx context.Context, login string, newLogin string,
+	reservation time.Duration) error {
+	ctx, done := is.start(ctx, "Rename")
+	err := is.storage.Rename(ctx, login, newLogin, reservation)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) IsReserved(ctx context.Context, login string) (bool, error) {
+	ctx, done := is.start(ctx, "IsReserved")
+	reserved, err := is.storage.IsReserved(ctx, login)
+	done(err)
+	return reserved, err
+}
+
+func (is *instrumentedStorage) Ping(ctx context.Context) error {
+	ctx, done := is.start(ctx, "Ping")
+	err := is.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (is *instrumentedStorage) Close() error {
+	return is.storage.Close()
+}
@@ -3,12 +3,17 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/Frank-Way/note-go-rest-service/internal/logging"
+	"github.com/Frank-Way/note-go-rest-service/internal/problem"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
 	"github.com/Frank-Way/note-go-rest-service/internal/user"
-	"github.com/Frank-Way/note-go-rest-service/internal/user/uerror"
 	"github.com/go-redis/redis"
 	"github.com/sirupsen/logrus"
 	"net"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var _ user.Storage = &redisStorage{}
@@ -18,20 +23,45 @@ type redisStorage struct {
 	logger *logrus.Logger
 }
 
-const nextIdKey = ".nextId1"
+const (
+	nextIdKey         = ".nextId1"
+	reservedKeyPrefix = ".reserved:"
+	externalKeyPrefix = ".external:"
+)
+
+func externalKey(identity user.ExternalIdentity) string {
+	return externalKeyPrefix + identity.Provider + ":" + identity.Subject
+}
+
+// redisUser is user's representation in redis. Password hash is not
+// serialized with user.User, so it is stored in separate field.
+type redisUser struct {
+	user.User
+	Password string `json:"password"`
+}
+
+func toRedisUser(u user.User) redisUser {
+	return redisUser{User: u, Password: u.Password}
+}
 
-func NewRedisStorage(host, port, password string, db int, logger *logrus.Logger) (user.Storage, error) {
+func (ru redisUser) toUser() user.User {
+	u := ru.User
+	u.Password = ru.Password
+	return u
+}
+
+func NewRedisStorage(host, port, password string, db int, timeout time.Duration, logger *logrus.Logger) (user.Storage, error) {
 	addr := net.JoinHostPort(host, port)
 	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
 	})
 	_, err := client.Ping().Result()
 	if err != nil {
-		storeErr := uerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB: " + addr
-		return nil, storeErr
+		return nil, problem.Storage.Wrap(fmt.Errorf("no connection to redis at %s: %w", addr, err))
 	}
 	return &redisStorage{
 		client: client,
@@ -39,142 +69,310 @@ func NewRedisStorage(host, port, password string, db int, logger *logrus.Logger)
 	}, nil
 }
 
+// with returns client which traces commands as part of ctx.
+func (rs *redisStorage) with(ctx context.Context) *redis.Client {
+	return tracing.Redis(ctx, rs.client)
+}
+
 func (rs *redisStorage) Save(ctx context.Context, user user.User) (string, error) {
-	rs.logger.Info("save user to redis storage")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		rs.logger.Debug("No connection to Redis DB")
-		storeErr := uerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return "", storeErr
-	}
-	rs.logger.Debug("generate password hash")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("save user to redis storage")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return "", problem.Storage.Wrap(err)
+	}
+	logger.Debug("generate password hash")
 	if err := user.GeneratePasswordHash(); err != nil {
-		rs.logger.Debugf("error during password hashing: %v", err)
+		logger.Debugf("error during password hashing: %v", err)
 		return "", err
 	}
-	rs.logger.Debug("get new id from redis")
-	nextIdStr, err := rs.client.Get(nextIdKey).Result()
+	logger.Debug("get new id from redis")
+	nextIdStr, err := rs.with(ctx).Get(nextIdKey).Result()
 	if err != nil {
-		rs.logger.Debugf("error during getting next id: %v", err)
-		rs.logger.Debug("set next id to 1")
+		logger.Debugf("error during getting next id: %v", err)
+		logger.Debug("set next id to 1")
 		nextIdStr = "1"
-		err = rs.client.Set(nextIdKey, "2", 0).Err()
+		err = rs.with(ctx).Set(nextIdKey, "2", 0).Err()
 		if err != nil {
 			return "", err
 		}
 	}
-	rs.logger.Debug("parse new id")
+	logger.Debug("parse new id")
 	nextId, err := strconv.Atoi(nextIdStr)
 	if err != nil {
-		rs.logger.Debugf("error during parsing next id: %v", err)
+		logger.Debugf("error during parsing next id: %v", err)
 		return "", err
 	}
-	rs.logger.Debug("set new id to user")
+	logger.Debug("set new id to user")
 	user.Id = int(nextId)
-	rs.logger.Debug("incr id in redis")
-	rs.client.Incr(nextIdKey)
-	rs.logger.Debug("marshaling user")
-	bytes, err := json.Marshal(user)
+	logger.Debug("incr id in redis")
+	rs.with(ctx).Incr(nextIdKey)
+	logger.Debug("marshaling user")
+	bytes, err := json.Marshal(toRedisUser(user))
 	if err != nil {
-		rs.logger.Debugf("error during marshaling user: %v", err)
+		logger.Debugf("error during marshaling user: %v", err)
 		return "", err
 	}
-	rs.logger.Debug("save user in redis")
-	if err = rs.client.Set(user.Login, bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving user: %v", err)
+	logger.Debug("save user in redis")
+	if err = rs.with(ctx).Set(user.Login, bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving user: %v", err)
 		return "", err
 	}
+	for _, identity := range user.ExternalIdentities {
+		logger.Debugf("link external identity %v", identity)
+		if err = rs.with(ctx).Set(externalKey(identity), user.Login, 0).Err(); err != nil {
+			logger.Debugf("error during saving external identity: %v", err)
+			return "", err
+		}
+	}
 	return user.Login, nil
 }
 
 func (rs *redisStorage) GetByLogin(ctx context.Context, login string) (user.User, error) {
-	rs.logger.Info("get user from redis")
-	rs.logger.Tracef("get user by login: %s", login)
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		rs.logger.Debug("No connection to Redis DB")
-		storeErr := uerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return user.User{}, storeErr
-	}
-	rs.logger.Debug("check if user exists")
-	u, err := rs.findUserByLogin(login)
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get user from redis")
+	logger.Tracef("get user by login: %s", login)
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return user.User{}, problem.Storage.Wrap(err)
+	}
+	logger.Debug("check if user exists")
+	u, err := rs.findUserByLogin(ctx, login)
 	if err != nil {
-		rs.logger.Debugf("error during getting user by login: %v", err)
-		sErr := uerror.ErrorNotFound
-		sErr.Err = err
-		return user.User{}, sErr
+		logger.Debugf("error during getting user by login: %v", err)
+		return user.User{}, err
 	}
-	rs.logger.Tracef("user: %v", u)
+	logger.Tracef("user: %v", u)
 	return u, nil
 }
 
+func (rs *redisStorage) GetByExternalIdentity(ctx context.Context, identity user.ExternalIdentity) (user.User, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get user by external identity from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return user.User{}, problem.Storage.Wrap(err)
+	}
+	logger.Debugf("get login by external identity: %v", identity)
+	login, err := rs.with(ctx).Get(externalKey(identity)).Result()
+	if err == redis.Nil {
+		logger.Debugf("user was not found, identity: %v", identity)
+		return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with %s identity '%s' not found", identity.Provider, identity.Subject))
+	} else if err != nil {
+		logger.Debugf("error during getting login by external identity: %v", err)
+		return user.User{}, problem.Storage.Wrap(err)
+	}
+	return rs.GetByLogin(ctx, login)
+}
+
+// GetById scans all users, since users are keyed by login.
 func (rs *redisStorage) GetById(ctx context.Context, id int) (user.User, error) {
-	//TODO implement me
-	panic("implement me")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get user from redis")
+	logger.Debugf("find user by id: %d", id)
+	users, err := rs.GetAll(ctx)
+	if err != nil {
+		logger.Debugf("error during getting users: %v", err)
+		return user.User{}, err
+	}
+	for _, u := range users {
+		if u.Id == id {
+			logger.Debug("user found")
+			return u, nil
+		}
+	}
+	logger.Debugf("user was not found, id: %d", id)
+	return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with id '%d' not found", id))
 }
 
 func (rs *redisStorage) GetAll(ctx context.Context) (user.Users, error) {
-	//TODO implement me
-	panic("implement me")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("get users from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return user.Users{}, problem.Storage.Wrap(err)
+	}
+	logger.Debug("scan user keys")
+	var res user.Users
+	iter := rs.with(ctx).Scan(0, "*", 100).Iterator()
+	for iter.Next() {
+		key := iter.Val()
+		if strings.HasPrefix(key, ".") {
+			continue
+		}
+		u, err := rs.findUserByLogin(ctx, key)
+		if err != nil {
+			logger.Debugf("error during getting user by key %q: %v", key, err)
+			return user.Users{}, err
+		}
+		res = append(res, u)
+	}
+	if err := iter.Err(); err != nil {
+		logger.Debugf("error during scanning keys: %v", err)
+		return user.Users{}, problem.Storage.Wrap(err)
+	}
+	logger.Debug("users found")
+	return res, nil
 }
 
 func (rs *redisStorage) Update(ctx context.Context, user user.User) error {
-	rs.logger.Info("update user in redis")
-	rs.logger.Debug("check if redis available")
-	if err := rs.client.Ping().Err(); err != nil {
-		rs.logger.Debug("No connection to Redis DB")
-		storeErr := uerror.ErrorStorage
-		storeErr.DeveloperMessage = "No connection to Redis DB"
-		return storeErr
-	}
-	rs.logger.Debug("get user")
-	_, err := rs.findUserByLogin(user.Login)
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("update user in redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return problem.Storage.Wrap(err)
+	}
+	logger.Debug("get user")
+	_, err := rs.findUserByLogin(ctx, user.Login)
 	if err != nil {
-		rs.logger.Debugf("error during getting user from redis: %v", err)
+		logger.Debugf("error during getting user from redis: %v", err)
 		return err
 	}
-	rs.logger.Debug("marshaling user")
-	bytes, err := json.Marshal(user)
+	logger.Debug("marshaling user")
+	bytes, err := json.Marshal(toRedisUser(user))
 	if err != nil {
-		rs.logger.Debugf("error during marshaling user: %v", err)
+		logger.Debugf("error during marshaling user: %v", err)
 		return err
 	}
-	rs.logger.Debug("save user in redis")
-	if err := rs.client.Set(user.Login, bytes, 0).Err(); err != nil {
-		rs.logger.Debugf("error during saving user: %v", err)
+	logger.Debug("save user in redis")
+	if err := rs.with(ctx).Set(user.Login, bytes, 0).Err(); err != nil {
+		logger.Debugf("error during saving user: %v", err)
 		return err
 	}
 	return nil
 }
 
 func (rs *redisStorage) DeleteByLogin(ctx context.Context, login string) error {
-	//TODO implement me
-	panic("implement me")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("delete user from redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return problem.Storage.Wrap(err)
+	}
+	logger.Tracef("delete user by login: %s", login)
+	keys := []string{login}
+	if u, err := rs.findUserByLogin(ctx, login); err == nil {
+		for _, identity := range u.ExternalIdentities {
+			keys = append(keys, externalKey(identity))
+		}
+	}
+	deleted, err := rs.with(ctx).Del(keys...).Result()
+	if err != nil {
+		logger.Debugf("error during deleting user: %v", err)
+		return problem.Storage.Wrap(err)
+	}
+	if deleted == 0 {
+		logger.Debugf("user was not found, login: %s", login)
+		return problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
+	}
+	return nil
 }
 
 func (rs *redisStorage) DeleteById(ctx context.Context, id int) error {
-	//TODO implement me
-	panic("implement me")
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("delete user from redis")
+	u, err := rs.GetById(ctx, id)
+	if err != nil {
+		logger.Debugf("error during getting user by id: %v", err)
+		return err
+	}
+	return rs.DeleteByLogin(ctx, u.Login)
 }
 
-func (rs *redisStorage) findUserByLogin(login string) (user.User, error) {
-	rs.logger.Tracef("find user by login: %s", login)
-	uStr, err := rs.client.Get(login).Result()
+func (rs *redisStorage) Rename(ctx context.Context, login string, newLogin string,
+	reservation time.Duration) error {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("rename user in redis")
+	logger.Debug("check if redis available")
+	if err := rs.with(ctx).Ping().Err(); err != nil {
+		logger.Debug("No connection to Redis DB")
+		return problem.Storage.Wrap(err)
+	}
+	logger.Debugf("rename user %q to %q in transaction", login, newLogin)
+	return rs.with(ctx).Watch(func(tx *redis.Tx) error {
+		exists, err := tx.Exists(newLogin).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			logger.Debug("new login is used by another user")
+			return problem.Conflict.WithDetail(fmt.Sprintf("there are user with specified login '%s'", newLogin))
+		}
+		uStr, err := tx.Get(login).Result()
+		if err == redis.Nil {
+			logger.Debugf("user was not found, login: %s", login)
+			return problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
+		} else if err != nil {
+			return err
+		}
+		var ru redisUser
+		if err = json.Unmarshal([]byte(uStr), &ru); err != nil {
+			return err
+		}
+		ru.Login = newLogin
+		bytes, err := json.Marshal(ru)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(newLogin, bytes, 0)
+			pipe.Del(login)
+			for _, identity := range ru.ExternalIdentities {
+				pipe.Set(externalKey(identity), newLogin, 0)
+			}
+			pipe.Del(reservedKeyPrefix + newLogin)
+			if reservation > 0 {
+				pipe.Set(reservedKeyPrefix+login, "1", reservation)
+			}
+			return nil
+		})
+		return err
+	}, login, newLogin)
+}
+
+func (rs *redisStorage) IsReserved(ctx context.Context, login string) (bool, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Info("check login reservation in redis")
+	exists, err := rs.with(ctx).Exists(reservedKeyPrefix + login).Result()
 	if err != nil {
-		rs.logger.Tracef("error in redis: %s", login)
-		sErr := uerror.ErrorStorage
-		sErr.Err = err
-		return user.User{}, sErr
+		logger.Debugf("error during checking reservation: %v", err)
+		return false, problem.Storage.Wrap(err)
 	}
-	var u user.User
-	err = json.Unmarshal([]byte(uStr), &u)
+	return exists > 0, nil
+}
+
+func (rs *redisStorage) findUserByLogin(ctx context.Context, login string) (user.User, error) {
+	logger := logging.FromContext(ctx, rs.logger)
+	logger.Tracef("find user by login: %s", login)
+	uStr, err := rs.with(ctx).Get(login).Result()
+	if err == redis.Nil {
+		logger.Tracef("user was not found, login: %s", login)
+		return user.User{}, problem.NotFound.WithDetail(fmt.Sprintf("user with login '%s' not found", login))
+	} else if err != nil {
+		logger.Tracef("error in redis: %s", login)
+		return user.User{}, problem.Storage.Wrap(err)
+	}
+	var ru redisUser
+	err = json.Unmarshal([]byte(uStr), &ru)
 	if err != nil {
-		sErr := uerror.ErrorStorage
-		sErr.Err = err
-		return user.User{}, sErr
+		return user.User{}, problem.Storage.Wrap(err)
 	}
-	rs.logger.Tracef("unmarshaled user: %v", u)
+	u := ru.toUser()
+	logger.Tracef("unmarshaled user: %v", u)
 	return u, err
 }
+
+func (rs *redisStorage) Ping(ctx context.Context) error {
+	return rs.with(ctx).Ping().Err()
+}
+
+func (rs *redisStorage) Close() error {
+	rs.logger.Info("close user redis storage")
+	return rs.client.Close()
+}
@@ -0,0 +1,131 @@
+package user
+
+import (
+	"context"
+	"github.com/Frank-Way/note-go-rest-service/internal/auth"
+	"github.com/Frank-Way/note-go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ Service = &tracingService{}
+
+// tracingService records span for every call of wrapped service.
+type tracingService struct {
+	service Service
+}
+
+func NewTracingService(service Service) Service {
+	return &tracingService{service: service}
+}
+
+func loginAttribute(login string) attribute.KeyValue {
+	return attribute.String("user.login", login)
+}
+
+func (ts *tracingService) SignUp(ctx context.Context, dto CreateUserDTO) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.SignUp", loginAttribute(dto.Login))
+	login, err := ts.service.SignUp(ctx, dto)
+	tracing.End(span, err)
+	return login, err
+}
+
+func (ts *tracingService) SignIn(ctx context.Context, login string, dto AuthUserDTO) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.SignIn", loginAttribute(login))
+	token, err := ts.service.SignIn(ctx, login, dto)
+	tracing.End(span, err)
+	return token, err
+}
+
+func (ts *tracingService) SignInExternal(ctx context.Context, dto ExternalSignInDTO) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.SignInExternal",
+		attribute.String("user.identity_provider", dto.Identity.Provider))
+	token, err := ts.service.SignInExternal(ctx, dto)
+	tracing.End(span, err)
+	return token, err
+}
+
+func (ts *tracingService) CheckCredentials(ctx context.Context, login string, password string) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.CheckCredentials", loginAttribute(login))
+	localLogin, err := ts.service.CheckCredentials(ctx, login, password)
+	tracing.End(span, err)
+	return localLogin, err
+}
+
+func (ts *tracingService) GetPrincipal(ctx context.Context, login string) (auth.Principal, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.GetPrincipal", loginAttribute(login))
+	p, err := ts.service.GetPrincipal(ctx, login)
+	tracing.End(span, err)
+	return p, err
+}
+
+func (ts *tracingService) ChangePassword(ctx context.Context, dto UpdateUserDTO) error {
+	ctx, span := tracing.Start(ctx, "user.Service.ChangePassword")
+	err := ts.service.ChangePassword(ctx, dto)
+	tracing.End(span, err)
+	return err
+}
+
+func (ts *tracingService) DeleteUser(ctx context.Context, login string, purge bool) error {
+	ctx, span := tracing.Start(ctx, "user.Service.DeleteUser", loginAttribute(login),
+		attribute.Bool("user.purge", purge))
+	err := ts.service.DeleteUser(ctx, login, purge)
+	tracing.End(span, err)
+	return err
+}
+
+func (ts *tracingService) PurgeDeactivated(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.PurgeDeactivated")
+	count, err := ts.service.PurgeDeactivated(ctx)
+	span.SetAttributes(attribute.Int("user.purged", count))
+	tracing.End(span, err)
+	return count, err
+}
+
+func (ts *tracingService) Rename(ctx context.Context, login string, dto RenameUserDTO) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.Rename", loginAttribute(login))
+	newLogin, err := ts.service.Rename(ctx, login, dto)
+	tracing.End(span, err)
+	return newLogin, err
+}
+
+func (ts *tracingService) ListSessions(ctx context.Context, login string) ([]SessionDTO, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.ListSessions", loginAttribute(login))
+	sessions, err := ts.service.ListSessions(ctx, login)
+	tracing.End(span, err)
+	return sessions, err
+}
+
+func (ts *tracingService) RevokeSession(ctx context.Context, login string, id string) error {
+	ctx, span := tracing.Start(ctx, "user.Service.RevokeSession", loginAttribute(login))
+	err := ts.service.RevokeSession(ctx, login, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (ts *tracingService) GetProfile(ctx context.Context, login string) (ProfileDTO, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.GetProfile", loginAttribute(login))
+	profile, err := ts.service.GetProfile(ctx, login)
+	tracing.End(span, err)
+	return profile, err
+}
+
+func (ts *tracingService) UpdateProfile(ctx context.Context, login string, dto PatchUserDTO) (ProfileDTO, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.UpdateProfile", loginAttribute(login))
+	profile, err := ts.service.UpdateProfile(ctx, login, dto)
+	tracing.End(span, err)
+	return profile, err
+}
+
+func (ts *tracingService) VerifyEmail(ctx context.Context, login string, token string) error {
+	ctx, span := tracing.Start(ctx, "user.Service.VerifyEmail", loginAttribute(login))
+	err := ts.service.VerifyEmail(ctx, login, token)
+	tracing.End(span, err)
+	return err
+}
+
+func (ts *tracingService) ResendVerification(ctx context.Context, login string) error {
+	ctx, span := tracing.Start(ctx, "user.Service.ResendVerification", loginAttribute(login))
+	err := ts.service.ResendVerification(ctx, login)
+	tracing.End(span, err)
+	return err
+}
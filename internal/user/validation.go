@@ -0,0 +1,57 @@
+package user
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+const maxDisplayNameLength = 100
+
+var (
+	loginFormatRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	localeRe      = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+)
+
+func validateLogin(login string) error {
+	if !loginFormatRe.MatchString(login) {
+		return fmt.Errorf("login must contain only latin letters, digits and underscores: %q", login)
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if _, err := netmail.ParseAddress(email); err != nil {
+		return fmt.Errorf("invalid email: %q", email)
+	}
+	return nil
+}
+
+func validateProfile(u User) error {
+	if utf8.RuneCountInString(u.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("display name must be at most %d characters", maxDisplayNameLength)
+	}
+	if u.Email != "" {
+		if err := validateEmail(u.Email); err != nil {
+			return err
+		}
+	}
+	if u.AvatarUrl != "" {
+		avatarUrl, err := url.Parse(u.AvatarUrl)
+		if err != nil || (avatarUrl.Scheme != "http" && avatarUrl.Scheme != "https") || avatarUrl.Host == "" {
+			return fmt.Errorf("avatar url must be absolute http(s) url: %q", u.AvatarUrl)
+		}
+	}
+	if u.Timezone != "" {
+		if _, err := time.LoadLocation(u.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone: %q", u.Timezone)
+		}
+	}
+	if u.Locale != "" && !localeRe.MatchString(u.Locale) {
+		return fmt.Errorf("invalid locale: %q", u.Locale)
+	}
+	return nil
+}